@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+type apiError struct {
+	Status  int                  `json:"status"`
+	Code    client.ErrorCode     `json:"code,omitempty"`
+	Message string               `json:"message"`
+	Errors  []client.ErrorDetail `json:"registryErrors,omitempty"`
+}
+
+// abortAPI passes on the code and payload of registry errors
+func abortAPI(c *gin.Context, status int, err error) {
+	e := apiError{Status: status, Message: err.Error()}
+
+	var regErr *client.RegistryError
+	if errors.As(err, &regErr) {
+		e.Code = regErr.Code()
+		e.Errors = regErr.Errors
+		if regErr.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(regErr.RetryAfter.Seconds()))))
+		}
+	}
+
+	c.JSON(status, gin.H{"error": e})
+}
+
+func apiGetRepos(c *gin.Context) {
+	page, err := pageQuery(c, repoSortKeys, "name", "asc")
+	if err != nil {
+		abortAPI(c, http.StatusBadRequest, err)
+		return
+	}
+
+	repos, refreshed, err := loadRepos(c.Request.Context())
+	if err != nil {
+		abortAPI(c, errorStatus(err), err)
+		return
+	}
+
+	sortRepos(repos, page.Sort, page.Order == "desc")
+	start, end := page.slice(len(repos))
+
+	resp := gin.H{"registry": gRegistry, "repositories": repos[start:end], "page": page}
+	if !refreshed.IsZero() {
+		resp["refreshed"] = refreshed
+	}
+	if limit, ok := gClient.RateLimit(); ok {
+		resp["rateLimit"] = gin.H{"limit": limit.Limit, "remaining": limit.Remaining, "windowSeconds": int(limit.Window.Seconds())}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func apiGetTags(c *gin.Context) {
+	repo, err := repoParam(c)
+	if err != nil {
+		abortAPI(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := pageQuery(c, tagSortKeys, "created", "desc")
+	if err != nil {
+		abortAPI(c, http.StatusBadRequest, err)
+		return
+	}
+
+	tagsInfo, _, refreshed, err := loadTagsPage(c.Request.Context(), repo, labelsQuery(c), &page)
+	if err != nil {
+		abortAPI(c, errorStatus(err), err)
+		return
+	}
+
+	resp := gin.H{"registry": gRegistry, "name": repo, "tags": tagsInfo, "page": page}
+	if !refreshed.IsZero() {
+		resp["refreshed"] = refreshed
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func apiGetImage(c *gin.Context) {
+	repo, tag, err := imageParam(c)
+	if err != nil {
+		abortAPI(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := gClient.GetPlatformImageInfoContext(c.Request.Context(), repo, tag, c.Query("platform"))
+	if err != nil {
+		abortAPI(c, errorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func apiGetLayers(c *gin.Context) {
+	repo, tag, err := imageParam(c)
+	if err != nil {
+		abortAPI(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := gClient.GetPlatformImageInfoContext(c.Request.Context(), repo, tag, c.Query("platform"))
+	if err != nil {
+		abortAPI(c, errorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"name": repo, "tag": tag, "platform": info.Platform, "layers": info.Layers})
+}
+
+// no csrf token here, browsers only send DELETE cross-site after a CORS preflight we never allow
+func apiDeleteImage(c *gin.Context) {
+	repo, tag, err := imageParam(c)
+	if err != nil {
+		abortAPI(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if c.Query("untag") != "" {
+		if err := gClient.UntagTagContext(c.Request.Context(), repo, tag); err != nil {
+			abortAPI(c, errorStatus(err), err)
+			return
+		}
+		removeFromIndex(repo, "", tag)
+
+		c.JSON(http.StatusOK, gin.H{"name": repo, "tag": tag, "deleted": true, "deletedTags": []string{tag}})
+		return
+	}
+
+	digest, shared, err := gClient.TagsSharingDigestContext(c.Request.Context(), repo, tag)
+	if err != nil {
+		abortAPI(c, errorStatus(err), err)
+		return
+	}
+
+	if err := gClient.DeleteManifestContext(c.Request.Context(), repo, digest); err != nil {
+		abortAPI(c, errorStatus(err), err)
+		return
+	}
+	removeFromIndex(repo, digest, "")
+
+	c.JSON(http.StatusOK, gin.H{"name": repo, "tag": tag, "deleted": true, "digest": digest,
+		"deletedTags": append([]string{tag}, shared...)})
+}
@@ -0,0 +1,260 @@
+// Reference: https://docs.docker.com/registry/spec/auth/token/
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type authChallenge struct {
+	Scheme string
+	Params map[string]string
+}
+
+type tokenResp struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type bearerToken struct {
+	token   string
+	expires time.Time
+}
+
+// WWW-Authenticate: Bearer realm="https://auth.example.com/token",service="registry",scope="repository:foo:pull"
+func parseAuthChallenge(header string) *authChallenge {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil
+	}
+
+	challenge := &authChallenge{Params: make(map[string]string)}
+	index := strings.IndexAny(header, " \t")
+	if index < 0 {
+		challenge.Scheme = strings.ToLower(header)
+		return challenge
+	}
+	challenge.Scheme = strings.ToLower(header[:index])
+
+	rest := header[index+1:]
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimLeft(rest[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// quoted value, may contain commas, e.g. scope="repository:foo:pull,push"
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value = b.String()
+			if i < len(rest) {
+				i++
+			}
+			rest = rest[i:]
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		challenge.Params[key] = value
+	}
+
+	return challenge
+}
+
+// tokenKey identifies which cached token a request can reuse, tokens are granted per repository and action
+func tokenKey(method string, path string) string {
+	// urls given by the registry, eg, https://host/prefix/v2/<name>/blobs/uploads/<uuid>
+	if isAbsoluteURL(path) {
+		if u, err := url.Parse(path); err == nil {
+			path = u.Path
+			if index := strings.Index(path, "/v2/"); index >= 0 {
+				path = path[index+len("/v2/"):]
+			}
+		}
+	}
+
+	path = strings.Trim(path, "/\\")
+	if path == "" {
+		return ""
+	}
+	if strings.HasPrefix(path, "_catalog") {
+		return "registry:catalog:*"
+	}
+
+	if index := strings.Index(path, "?"); index >= 0 {
+		path = path[:index]
+	}
+
+	// names may contain the separators too, eg, team/tags/api/manifests/v1, what follows the last one
+	// is a reference, digest or upload id which never has a slash
+	name := path
+	end := -1
+	for _, sep := range []string{"/tags/", "/manifests/", "/blobs/"} {
+		if index := strings.LastIndex(path, sep); index > end {
+			end = index
+		}
+	}
+	if end > 0 {
+		name = path[:end]
+	}
+
+	action := "pull"
+	if method != http.MethodGet && method != http.MethodHead {
+		action = "push"
+	}
+
+	return "repository:" + name + ":" + action
+}
+
+// tokenLifetime is how long we use a token given for expiresIn seconds, a little less so it does not expire
+// on the way. Spec: if expires_in is absent the token is valid for 60 seconds
+func tokenLifetime(expiresIn int) time.Duration {
+	if expiresIn <= 0 {
+		expiresIn = 60
+	}
+	lifetime := time.Duration(expiresIn) * time.Second
+
+	margin := 10 * time.Second
+	if margin > lifetime/10 {
+		margin = lifetime / 10
+	}
+	return lifetime - margin
+}
+
+func (c *RegistryClient) hasCredentials() bool {
+	return c.username != "" || c.password != ""
+}
+
+func (c *RegistryClient) isBasicAuth() bool {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	return c.basicAuth
+}
+
+// authorization is the Authorization header to send upfront, empty if we have not been challenged yet
+func (c *RegistryClient) authorization(key string) string {
+	if c.isBasicAuth() {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.username+":"+c.password))
+	}
+
+	if token := c.cachedToken(key); token != "" {
+		return "Bearer " + token
+	}
+
+	return ""
+}
+
+func (c *RegistryClient) cachedToken(key string) string {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	token, ok := c.tokens[key]
+	if !ok {
+		return ""
+	}
+	if time.Now().After(token.expires) {
+		delete(c.tokens, key)
+		return ""
+	}
+
+	return token.token
+}
+
+func (c *RegistryClient) fetchToken(ctx context.Context, key string, challenge *authChallenge) (string, error) {
+	realm := challenge.Params["realm"]
+	if realm == "" {
+		return "", errors.New("bearer challenge without realm")
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", errors.New("invalid token realm[" + realm + "], error: " + err.Error())
+	}
+
+	query := u.Query()
+	if service := challenge.Params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope := challenge.Params["scope"]; scope != "" {
+		for _, s := range strings.Split(scope, " ") {
+			query.Add("scope", s)
+		}
+	}
+
+	var req *http.Request
+	if c.username == identityTokenUsername {
+		// identity token from docker login, exchange it with the oauth2 refresh_token grant
+		query.Set("grant_type", "refresh_token")
+		query.Set("refresh_token", c.password)
+		query.Set("client_id", "docker-registry-viewer")
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(query.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		u.RawQuery = query.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if c.hasCredentials() {
+			req.SetBasicAuth(c.username, c.password)
+		}
+	}
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	r := &registryResp{StatusCode: httpResp.StatusCode, Stream: httpResp.Body}
+	defer closeBody(r)
+
+	if httpResp.StatusCode != 200 {
+		return "", errors.New("get token from [" + realm + "] fail: " + httpResp.Status)
+	}
+
+	var t tokenResp
+	if err := c.decodeBody(r, &t); err != nil {
+		return "", errors.New("can not decode token from [" + realm + "], error: " + err.Error())
+	}
+
+	token := t.Token
+	if token == "" {
+		token = t.AccessToken
+	}
+	if token == "" {
+		return "", errors.New("empty token from [" + realm + "]")
+	}
+
+	// local clock instead of issued_at, avoid clock skew between us and the token server
+	expires := time.Now().Add(tokenLifetime(t.ExpiresIn))
+
+	c.tokenMutex.Lock()
+	c.tokens[key] = bearerToken{token: token, expires: expires}
+	c.tokenMutex.Unlock()
+
+	return token, nil
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAuthChallenge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   *authChallenge
+	}{
+		{"", nil},
+		{"Basic", &authChallenge{Scheme: "basic", Params: map[string]string{}}},
+		{`Basic realm="registry"`, &authChallenge{Scheme: "basic", Params: map[string]string{"realm": "registry"}}},
+		{`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:foo:pull"`,
+			&authChallenge{Scheme: "bearer", Params: map[string]string{
+				"realm": "https://auth.example.com/token", "service": "registry", "scope": "repository:foo:pull"}}},
+		{`Bearer realm="https://auth.example.com/token", scope="repository:foo:pull,push"`,
+			&authChallenge{Scheme: "bearer", Params: map[string]string{
+				"realm": "https://auth.example.com/token", "scope": "repository:foo:pull,push"}}},
+		{`Bearer Realm=https://auth.example.com/token,Service=registry`,
+			&authChallenge{Scheme: "bearer", Params: map[string]string{
+				"realm": "https://auth.example.com/token", "service": "registry"}}},
+		{`Bearer realm="a \"quoted\" realm"`, &authChallenge{Scheme: "bearer", Params: map[string]string{"realm": `a "quoted" realm`}}},
+		{`Bearer realm="unterminated`, &authChallenge{Scheme: "bearer", Params: map[string]string{"realm": "unterminated"}}},
+	}
+
+	for _, test := range tests {
+		if got := parseAuthChallenge(test.header); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseAuthChallenge(%q) = %+v, want %+v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestTokenKey(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "", ""},
+		{http.MethodGet, "_catalog?n=100", "registry:catalog:*"},
+		{http.MethodGet, "library/alpine/tags/list?n=100", "repository:library/alpine:pull"},
+		{http.MethodHead, "library/alpine/manifests/3.19", "repository:library/alpine:pull"},
+		{http.MethodGet, "alpine/blobs/sha256:ab12", "repository:alpine:pull"},
+		{http.MethodDelete, "alpine/manifests/sha256:ab12", "repository:alpine:push"},
+		{http.MethodPost, "alpine/blobs/uploads/", "repository:alpine:push"},
+		{http.MethodPatch, "alpine/blobs/uploads/0f3a?_state=x", "repository:alpine:push"},
+		// names holding the separators themselves
+		{http.MethodGet, "team/tags/api/manifests/v1", "repository:team/tags/api:pull"},
+		{http.MethodGet, "team/manifests/tags/list?n=100&last=a", "repository:team/manifests:pull"},
+		{http.MethodPut, "a/blobs/uploads/blobs/uploads/0f3a", "repository:a/blobs/uploads:push"},
+		{http.MethodGet, "team/blobs/api/tags/list?last=x/blobs/y", "repository:team/blobs/api:pull"},
+		// urls given by the registry
+		{http.MethodPut, "https://registry.example.com/v2/team/tags/api/blobs/uploads/0f3a?_state=x&digest=sha256:ab12",
+			"repository:team/tags/api:push"},
+		{http.MethodPatch, "https://example.com/prefix/v2/alpine/blobs/uploads/0f3a", "repository:alpine:push"},
+	}
+
+	for _, test := range tests {
+		if got := tokenKey(test.method, test.path); got != test.want {
+			t.Errorf("tokenKey(%s, %q) = %q, want %q", test.method, test.path, got, test.want)
+		}
+	}
+}
+
+func TestTokenLifetime(t *testing.T) {
+	tests := []struct {
+		expiresIn int
+		want      time.Duration
+	}{
+		{0, 54 * time.Second},
+		{-1, 54 * time.Second},
+		{1, 900 * time.Millisecond},
+		{10, 9 * time.Second},
+		{60, 54 * time.Second},
+		{300, 290 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := tokenLifetime(test.expiresIn); got != test.want {
+			t.Errorf("tokenLifetime(%d) = %s, want %s", test.expiresIn, got, test.want)
+		}
+	}
+}
+
+func TestBearerTokenScope(t *testing.T) {
+	var scopes []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			scopes = append(scopes, r.URL.Query().Get("scope"))
+			w.Write([]byte(`{"token": "` + r.URL.Query().Get("scope") + `", "expires_in": 5}`))
+			return
+		}
+
+		scope := "repository:team/tags/api:pull"
+		if r.Header.Get("Authorization") != "Bearer "+scope {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="registry",scope="`+scope+`"`)
+			w.WriteHeader(401)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", "sha256:ab12")
+	}))
+	defer srv.Close()
+
+	c, err := NewRegistryClient("http", strings.TrimPrefix(srv.URL, "http://"), WithCredentials("user", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []string{"v1", "v2"} {
+		digest, err := c.GetDigestContext(context.Background(), "team/tags/api", tag)
+		if err != nil {
+			t.Fatalf("GetDigest: %v", err)
+		}
+		if digest != "sha256:ab12" {
+			t.Errorf("GetDigest = %s, want sha256:ab12", digest)
+		}
+	}
+
+	// the second request reuses the token
+	if !reflect.DeepEqual(scopes, []string{"repository:team/tags/api:pull"}) {
+		t.Errorf("token scopes asked = %v, want one for team/tags/api", scopes)
+	}
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ERR_DIGEST_MISMATCH = errors.New("blob does not match its digest")
+	ERR_SIZE_MISMATCH   = errors.New("blob does not match its size")
+)
+
+// GetBlobContext streams blob digest of repository name, eg, a layer or a config, size is -1 when the registry
+// does not say. The reader is not capped nor verified, close it when done
+func (c *RegistryClient) GetBlobContext(ctx context.Context, name string, digest string) (io.ReadCloser, int64, error) {
+	r, err := c.doStream(ctx, http.MethodGet, name+"/blobs/"+digest, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if r.StatusCode != 200 {
+		return nil, 0, newRegistryError(r)
+	}
+
+	return r.Stream, r.ContentLength, nil
+}
+
+// DownloadBlobContext writes blob digest of repository name to w and checks its digest, and its size unless size is -1.
+// A transfer broken midway is resumed with a Range request. It returns how many bytes were written
+func (c *RegistryClient) DownloadBlobContext(ctx context.Context, name string, digest string, size int64, w io.Writer) (int64, error) {
+	return c.ResumeBlobContext(ctx, name, digest, size, nil, w)
+}
+
+// ResumeBlobContext continues a download, partial gives the bytes downloaded before, eg, an unfinished file,
+// they are read again to check the digest. It returns the size of the whole blob written so far
+func (c *RegistryClient) ResumeBlobContext(ctx context.Context, name string, digest string, size int64, partial io.Reader, w io.Writer) (int64, error) {
+	h, err := newDigester(digest)
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	if partial != nil {
+		if offset, err = io.Copy(h, partial); err != nil {
+			return 0, err
+		}
+	}
+
+	for attempt := 0; size < 0 || offset < size; attempt++ {
+		// registries may send more than announced, stop reading once it can not match anymore
+		limit := int64(-1)
+		if size >= 0 {
+			limit = size - offset + 1
+		}
+
+		n, resumable, err := c.fetchBlob(ctx, name, digest, offset, limit, io.MultiWriter(w, h))
+		offset += n
+		if err == nil {
+			break
+		}
+		if !resumable || ctx.Err() != nil || attempt >= c.retry.MaxRetries {
+			return offset, fmt.Errorf("can not download blob[%s] of [%s], error: %w", digest, name, err)
+		}
+	}
+
+	if size >= 0 && offset != size {
+		return offset, fmt.Errorf("blob[%s] of [%s] has %d bytes instead of %d: %w", digest, name, offset, size, ERR_SIZE_MISMATCH)
+	}
+	if got := digest[:strings.Index(digest, ":")+1] + fmt.Sprintf("%x", h.Sum(nil)); got != digest {
+		return offset, fmt.Errorf("blob[%s] of [%s] downloaded as %s: %w", digest, name, got, ERR_DIGEST_MISMATCH)
+	}
+
+	return offset, nil
+}
+
+func newDigester(digest string) (hash.Hash, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) == 2 && parts[1] != "" {
+		switch parts[0] {
+		case "sha256":
+			return sha256.New(), nil
+		case "sha512":
+			return sha512.New(), nil
+		}
+	}
+	return nil, errors.New("unsupported digest: " + digest)
+}
+
+// fetchBlob writes blob digest from offset on to w, at most limit bytes unless limit is -1.
+// resumable tells whether the error broke the transfer midway
+func (c *RegistryClient) fetchBlob(ctx context.Context, name string, digest string, offset int64, limit int64, w io.Writer) (int64, bool, error) {
+	headers := make(map[string]string)
+	if offset > 0 {
+		headers["Range"] = "bytes=" + strconv.FormatInt(offset, 10) + "-"
+	}
+
+	// GET is retried by sendRequest already, errors before the body are final here
+	r, err := c.doStream(ctx, http.MethodGet, name+"/blobs/"+digest, headers, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer closeBody(r)
+
+	switch {
+	case r.StatusCode == 206:
+		if !strings.HasPrefix(r.ContentRange, "bytes "+strconv.FormatInt(offset, 10)+"-") {
+			return 0, false, errors.New("asked blob from byte " + strconv.FormatInt(offset, 10) + " but got range " + r.ContentRange)
+		}
+
+	case r.StatusCode == 200:
+		// no range support, skip what we already have
+		if offset > 0 {
+			if _, err := io.CopyN(ioutil.Discard, r.Stream, offset); err != nil {
+				return 0, true, err
+			}
+		}
+
+	case r.StatusCode == 416 && offset > 0:
+		// nothing left after offset
+		return 0, false, nil
+
+	default:
+		return 0, false, newRegistryError(r)
+	}
+
+	var reader io.Reader = r.Stream
+	if limit >= 0 {
+		reader = io.LimitReader(reader, limit)
+	}
+	body := &errorReader{reader: reader}
+	n, err := io.Copy(w, body)
+	return n, body.err != nil, err
+}
+
+// errorReader remembers the read error, to tell a broken download from a failing writer
+type errorReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blobServer serves blob at /v2/x/blobs/<digest>. The first cut responses stop after half of what they announce,
+// ranges are answered only when ranges is set
+func blobServer(blob []byte, cut int, ranges bool) (*httptest.Server, *[]string) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.Header.Get("Range"))
+
+		offset := 0
+		if rng := r.Header.Get("Range"); rng != "" && ranges {
+			offset, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			w.Header().Set("Content-Range", "bytes "+strconv.Itoa(offset)+"-"+strconv.Itoa(len(blob)-1)+"/"+strconv.Itoa(len(blob)))
+		}
+		body := blob[offset:]
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if offset > 0 {
+			w.WriteHeader(206)
+		}
+
+		if len(requested) <= cut {
+			// the server closes the connection short of Content-Length
+			w.Write(body[:len(body)/2])
+			return
+		}
+		w.Write(body)
+	}))
+	return srv, &requested
+}
+
+func newBlobClient(t *testing.T, srv *httptest.Server) *RegistryClient {
+	c, err := NewRegistryClient("http", strings.TrimPrefix(srv.URL, "http://"),
+		WithRetry(RetryPolicy{MaxRetries: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDownloadBlob(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	digest := digestOf(blob)
+
+	tests := []struct {
+		name      string
+		cut       int
+		ranges    bool
+		size      int64
+		wantRange []string
+	}{
+		{"whole", 0, true, int64(len(blob)), []string{""}},
+		{"unknown size", 0, true, -1, []string{""}},
+		{"resumed with range", 1, true, int64(len(blob)), []string{"", "bytes=32768-"}},
+		{"resumed twice", 2, true, int64(len(blob)), []string{"", "bytes=32768-", "bytes=49152-"}},
+		{"resumed without range support", 1, false, int64(len(blob)), []string{"", "bytes=32768-"}},
+	}
+
+	for _, test := range tests {
+		srv, requested := blobServer(blob, test.cut, test.ranges)
+		c := newBlobClient(t, srv)
+
+		var out bytes.Buffer
+		n, err := c.DownloadBlobContext(context.Background(), "x", digest, test.size, &out)
+		if err != nil {
+			t.Errorf("%s: DownloadBlob: %v", test.name, err)
+		} else if n != int64(len(blob)) || !bytes.Equal(out.Bytes(), blob) {
+			t.Errorf("%s: DownloadBlob wrote %d bytes, want the %d of the blob", test.name, n, len(blob))
+		}
+		if strings.Join(*requested, ",") != strings.Join(test.wantRange, ",") {
+			t.Errorf("%s: ranges asked = %q, want %q", test.name, *requested, test.wantRange)
+		}
+		srv.Close()
+	}
+}
+
+func TestResumeBlob(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	digest := digestOf(blob)
+	srv, requested := blobServer(blob, 0, true)
+	defer srv.Close()
+	c := newBlobClient(t, srv)
+
+	var out bytes.Buffer
+	n, err := c.ResumeBlobContext(context.Background(), "x", digest, int64(len(blob)), bytes.NewReader(blob[:1000]), &out)
+	if err != nil {
+		t.Fatalf("ResumeBlob: %v", err)
+	}
+	if n != int64(len(blob)) || !bytes.Equal(out.Bytes(), blob[1000:]) {
+		t.Errorf("ResumeBlob = %d, wrote %d bytes, want %d and the %d after the partial", n, out.Len(), len(blob), len(blob)-1000)
+	}
+	if len(*requested) != 1 || (*requested)[0] != "bytes=1000-" {
+		t.Errorf("ranges asked = %q, want bytes=1000-", *requested)
+	}
+}
+
+func TestDownloadBlobMismatch(t *testing.T) {
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	srv, _ := blobServer(blob, 0, true)
+	defer srv.Close()
+	c := newBlobClient(t, srv)
+
+	tests := []struct {
+		name    string
+		digest  string
+		size    int64
+		partial []byte
+		want    error
+	}{
+		{"other digest", digestOf([]byte("other")), int64(len(blob)), nil, ERR_DIGEST_MISMATCH},
+		{"corrupt partial", digestOf(blob), int64(len(blob)), bytes.Repeat([]byte("x"), 1000), ERR_DIGEST_MISMATCH},
+		{"shorter than announced", digestOf(blob), int64(len(blob)) + 10, nil, ERR_SIZE_MISMATCH},
+		{"longer than announced", digestOf(blob), int64(len(blob)) - 10, nil, ERR_SIZE_MISMATCH},
+	}
+
+	for _, test := range tests {
+		var partial io.Reader
+		if test.partial != nil {
+			partial = bytes.NewReader(test.partial)
+		}
+		_, err := c.ResumeBlobContext(context.Background(), "x", test.digest, test.size, partial, &bytes.Buffer{})
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDownloadBlobUnsupportedDigest(t *testing.T) {
+	c, err := NewRegistryClient("http", "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, digest := range []string{"", "sha256", "sha256:", "md5:ab12"} {
+		if _, err := c.DownloadBlobContext(context.Background(), "x", digest, -1, &bytes.Buffer{}); err == nil {
+			t.Errorf("DownloadBlob(%q) succeeded, want an unsupported digest error", digest)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// DefaultMaxBodySize caps what is read into memory: manifests, configs, tag pages, tokens and error payloads.
+// Blobs streamed by GetBlob are not capped
+const DefaultMaxBodySize = 32 << 20
+
+// error payloads and bodies thrown away are read this far, then the connection is dropped instead
+const maxDrainSize = 64 << 10
+
+var (
+	ERR_BODY_TOO_LARGE = errors.New("response body too large")
+)
+
+// WithMaxBodySize caps bodies read into memory at size bytes, protection against hostile registries
+func WithMaxBodySize(size int64) Option {
+	return func(c *RegistryClient) error {
+		if size <= 0 {
+			return errors.New("max body size must be positive")
+		}
+		c.maxBodySize = size
+		return nil
+	}
+}
+
+// cappedReader fails with ERR_BODY_TOO_LARGE past max bytes instead of silently truncating
+type cappedReader struct {
+	reader io.Reader
+	left   int64
+}
+
+func newCappedReader(reader io.Reader, max int64) *cappedReader {
+	return &cappedReader{reader: io.LimitReader(reader, max+1), left: max}
+}
+
+func (r *cappedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.left -= int64(n)
+	if r.left < 0 {
+		return n + int(r.left), ERR_BODY_TOO_LARGE
+	}
+	return n, err
+}
+
+// readBody reads the open stream of r into r.Body and closes it
+func (c *RegistryClient) readBody(r *registryResp) error {
+	if r.Stream == nil {
+		return nil
+	}
+	defer closeBody(r)
+
+	body, err := ioutil.ReadAll(newCappedReader(r.Stream, c.maxBodySize))
+	if err != nil {
+		return err
+	}
+	r.Body = body
+	return nil
+}
+
+// decodeBody decodes JSON straight from the open stream of r, or from r.Body once read, and closes the stream
+func (c *RegistryClient) decodeBody(r *registryResp, v interface{}) error {
+	if r.Stream == nil {
+		return json.Unmarshal(r.Body, v)
+	}
+	defer closeBody(r)
+
+	return json.NewDecoder(newCappedReader(r.Stream, c.maxBodySize)).Decode(v)
+}
+
+// closeBody drains what is left of a small body so the connection can be reused
+func closeBody(r *registryResp) {
+	if r.Stream == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(r.Stream, maxDrainSize))
+	r.Stream.Close()
+	r.Stream = nil
+}
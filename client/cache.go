@@ -0,0 +1,211 @@
+package client
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Cache stores content addressed registry data: blob sizes, manifests by digest and config blobs.
+// Keys look like manifest/sha256:<hex>, values never change for a key. Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+}
+
+const DefaultCacheSize = 10000
+
+func WithCache(cache Cache) Option {
+	return func(c *RegistryClient) error {
+		if cache == nil {
+			return errors.New("nil cache")
+		}
+		c.cache = cache
+		return nil
+	}
+}
+
+var digestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+func cacheKey(kind string, digest string) string {
+	if !digestPattern.MatchString(digest) {
+		return ""
+	}
+	return kind + "/" + digest
+}
+
+func (c *RegistryClient) cacheGet(kind string, digest string) ([]byte, bool) {
+	key := cacheKey(kind, digest)
+	if key == "" {
+		return nil, false
+	}
+	return c.cache.Get(key)
+}
+
+func (c *RegistryClient) cacheSet(kind string, digest string, value []byte) {
+	if key := cacheKey(kind, digest); key != "" {
+		c.cache.Set(key, value)
+	}
+}
+
+// cachedManifest is how manifests are stored, the media type is needed to parse them again
+type cachedManifest struct {
+	MediaType string          `json:"mediaType"`
+	Body      json.RawMessage `json:"body"`
+}
+
+func (c *RegistryClient) cachedBlobSize(digest string) (uint64, bool) {
+	value, ok := c.cacheGet("blobsize", digest)
+	if !ok {
+		return 0, false
+	}
+
+	size, err := strconv.ParseUint(string(value), 10, 64)
+	return size, err == nil
+}
+
+// MemoryCache keeps the most recently used entries in memory
+type MemoryCache struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a LRU cache of at most size entries, DefaultCacheSize if size <= 0
+func NewMemoryCache(size int) *MemoryCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &MemoryCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (m *MemoryCache) Get(key string) ([]byte, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+func (m *MemoryCache) Set(key string, value []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		e.Value.(*memoryEntry).value = value
+		m.order.MoveToFront(e)
+		return
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value})
+	for m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// DiskCache stores each entry as a file under dir, eg, <dir>/manifest/sha256/<hex>.json, so it survives restarts.
+// Entries are never evicted, content addressed data only grows as fast as the registry does.
+type DiskCache struct {
+	dir string
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.New("can not create cache dir[" + dir + "], error: " + err.Error())
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (d *DiskCache) path(key string) string {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 || !digestPattern.MatchString(parts[1]) || strings.ContainsAny(parts[0], `/\.`) {
+		return ""
+	}
+	digest := strings.SplitN(parts[1], ":", 2)
+	return filepath.Join(d.dir, parts[0], digest[0], digest[1]+".json")
+}
+
+func (d *DiskCache) Get(key string) ([]byte, bool) {
+	path := d.path(key)
+	if path == "" {
+		return nil, false
+	}
+
+	value, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set writes to a temp file and renames it, readers never see half written entries
+func (d *DiskCache) Set(key string, value []byte) {
+	path := d.path(key)
+	if path == "" {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// layeredCache reads from the first cache having the key and copies it into the ones before,
+// eg, a MemoryCache in front of a DiskCache
+type layeredCache []Cache
+
+func NewLayeredCache(caches ...Cache) Cache {
+	return layeredCache(caches)
+}
+
+func (l layeredCache) Get(key string) ([]byte, bool) {
+	for i, cache := range l {
+		if value, ok := cache.Get(key); ok {
+			for j := 0; j < i; j++ {
+				l[j].Set(key, value)
+			}
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func (l layeredCache) Set(key string, value []byte) {
+	for _, cache := range l {
+		cache.Set(key, value)
+	}
+}
@@ -2,157 +2,397 @@
 package client
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-var (
-	ERR_IMAGE_NOT_FOUND = errors.New("image not found")
-)
-
+// RegistryClient is safe for concurrent use
 type RegistryClient struct {
 	host        string
+	username    string
+	password    string
 	httpClient  *http.Client
-	blobSizeMap map[string]uint64
+	cache       Cache
+	tokenMutex  sync.Mutex
+	tokens      map[string]bearerToken
+	basicAuth   bool
+	tlsOptions  TLSOptions
+	timeouts    Timeouts
+	connections ConnectionOptions
+	retry       RetryPolicy
+	limiter     *rateLimiter
+	rateMutex   sync.Mutex
+	rateLimit   RateLimit
+	maxBodySize int64
+	parallelism int
+	flight      flightGroup
+}
+
+type Option func(*RegistryClient) error
+
+func WithCredentials(username string, password string) Option {
+	return func(c *RegistryClient) error {
+		c.username = username
+		c.password = password
+		return nil
+	}
+}
+
+// DefaultParallelism is how many requests a call needing one per tag, eg, TagsWithDigest, sends at a time
+const DefaultParallelism = 8
+
+func WithParallelism(n int) Option {
+	return func(c *RegistryClient) error {
+		if n < 1 {
+			return errors.New("parallelism must be positive")
+		}
+		c.parallelism = n
+		return nil
+	}
+}
+
+// Timeouts bound each stage of a request, zero means no limit, the whole request is bound by its context
+type Timeouts struct {
+	Dial           time.Duration
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration
+}
+
+var DefaultTimeouts = Timeouts{Dial: 10 * time.Second, TLSHandshake: 10 * time.Second, ResponseHeader: 30 * time.Second}
+
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(c *RegistryClient) error {
+		c.timeouts = timeouts
+		return nil
+	}
 }
 
 type registryResp struct {
-	StatusCode    int
-	StatusString  string
-	Link          string
-	Digest        string
-	ContentLength uint64
-	Body          string
+	StatusCode   int
+	StatusString string
+	Link         string
+	Digest       string
+	ContentType  string
+	Location     string
+	Authenticate string
+	RetryAfter   string
+	// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+	RateLimitLimit     string
+	RateLimitRemaining string
+	RateLimitReset     string
+	ContentRange       string
+	// -1 when unknown
+	ContentLength int64
+	// doRequest reads the whole body into Body, doStream leaves it open in Stream for the caller to close
+	Body   []byte
+	Stream io.ReadCloser
 }
 
 type ImageInfo struct {
-	Name          string
-	Tag           string
-	DockerVersion string
-	CreatedTime   string
-	DigestV1      string
-	DigestV2      string
-	ExposedPorts  []string
-	Envs          []string
-	Cmd           string
-	Volumes       []string
-	WorkingDir    string
-	Entrypoint    string
-	Size          uint64
-	HumanSize     string
-	Layers        []ImageLayer
+	Name          string            `json:"name"`
+	Tag           string            `json:"tag"`
+	MediaType     string            `json:"mediaType"`
+	DockerVersion string            `json:"dockerVersion"`
+	CreatedTime   string            `json:"created"`
+	DigestV1      string            `json:"digestV1,omitempty"`
+	DigestV2      string            `json:"digest"`
+	ExposedPorts  []string          `json:"exposedPorts"`
+	Envs          []string          `json:"env"`
+	Cmd           string            `json:"cmd"`
+	Volumes       []string          `json:"volumes"`
+	WorkingDir    string            `json:"workingDir"`
+	Entrypoint    string            `json:"entrypoint"`
+	User          string            `json:"user"`
+	Author        string            `json:"author"`
+	Labels        map[string]string `json:"labels"`
+	StopSignal    string            `json:"stopSignal"`
+	StopTimeout   *int              `json:"stopTimeout,omitempty"`
+	Healthcheck   *HealthConfig     `json:"healthcheck,omitempty"`
+	Shell         string            `json:"shell"`
+	ArgsEscaped   bool              `json:"argsEscaped"`
+	OnBuild       []string          `json:"onBuild"`
+	OS            string            `json:"os"`
+	Architecture  string            `json:"architecture"`
+	Variant       string            `json:"variant,omitempty"`
+	Size          uint64            `json:"size"`
+	HumanSize     string            `json:"humanSize"`
+	Layers        []ImageLayer      `json:"layers"`
+	Platform      string            `json:"platform,omitempty"`
+	Platforms     []PlatformInfo    `json:"platforms,omitempty"`
 }
 
 type ImageLayer struct {
-	BlobSum     string
-	CreatedTime string
-	Size        uint64
-	HumanSize   string
-	Cmd         string
+	BlobSum     string `json:"digest"`
+	CreatedTime string `json:"created"`
+	Size        uint64 `json:"size"`
+	HumanSize   string `json:"humanSize"`
+	Cmd         string `json:"createdBy"`
+	Comment     string `json:"comment,omitempty"`
+	EmptyLayer  bool   `json:"emptyLayer"`
 }
 
-func NewRegistryClient(protocol string, host string) (*RegistryClient, error) {
-	httpClient := &http.Client{}
-
-	if protocol == "https" {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+func NewRegistryClient(protocol string, host string, options ...Option) (*RegistryClient, error) {
+	host = strings.Trim(host, "/\\")
+	c := &RegistryClient{host: protocol + "://" + host,
+		cache:       NewMemoryCache(DefaultCacheSize),
+		timeouts:    DefaultTimeouts,
+		retry:       DefaultRetryPolicy,
+		connections: DefaultConnectionOptions,
+		maxBodySize: DefaultMaxBodySize,
+		parallelism: DefaultParallelism,
+		tokens:      make(map[string]bearerToken)}
+
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
 		}
-		httpClient = &http.Client{Transport: tr}
 	}
 
-	return &RegistryClient{host: protocol + "://" + strings.Trim(host, "/\\"),
-		httpClient:  httpClient,
-		blobSizeMap: make(map[string]uint64)}, nil
-}
-
-func (c *RegistryClient) doRequest(method string, path string, headers map[string]string) (*registryResp, error) {
-	req, err := http.NewRequest(method, c.host+"/v2/"+strings.Trim(path, "/\\"), nil)
+	transport, err := c.newTransport(protocol, host)
 	if err != nil {
 		return nil, err
 	}
-	// http://craigwickesser.com/2015/01/golang-http-to-many-open-files/
-	req.Close = true
+	c.httpClient = &http.Client{Transport: transport, CheckRedirect: checkRedirect}
 
-	for k, v := range headers {
-		req.Header.Add(k, v)
+	return c, nil
+}
+
+// doRequest shares identical GET and HEAD requests in flight, responses are read only
+func (c *RegistryClient) doRequest(ctx context.Context, method string, path string, headers map[string]string) (*registryResp, error) {
+	if method != http.MethodGet && method != http.MethodHead {
+		return c.doRequestWithBody(ctx, method, path, headers, nil)
 	}
 
-	httpResp, err := c.httpClient.Do(req)
+	v, err := c.flight.Do(ctx, method+" "+path+" "+headers["Accept"], func() (interface{}, error) {
+		return c.doRequestWithBody(ctx, method, path, headers, nil)
+	})
 	if err != nil {
+		// the caller we shared with was canceled, not us
+		if isContextError(err) && ctx.Err() == nil {
+			return c.doRequestWithBody(ctx, method, path, headers, nil)
+		}
 		return nil, err
 	}
-	defer httpResp.Body.Close()
+	return v.(*registryResp), nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
 
-	bodyLenth, err := strconv.ParseUint(httpResp.Header.Get("Content-Length"), 10, 64)
+// doRequestWithBody reads the whole response, at most maxBodySize
+func (c *RegistryClient) doRequestWithBody(ctx context.Context, method string, path string, headers map[string]string, body []byte) (*registryResp, error) {
+	r, err := c.doStream(ctx, method, path, headers, body)
 	if err != nil {
-		bodyLenth = 0
+		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(httpResp.Body)
+	if err := c.readBody(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// doStream answers a basic or bearer challenge and retries once, the body of the response is left open in Stream
+func (c *RegistryClient) doStream(ctx context.Context, method string, path string, headers map[string]string, body []byte) (*registryResp, error) {
+	key := tokenKey(method, path)
+
+	r, err := c.sendRequest(ctx, method, path, headers, body, c.authorization(key))
 	if err != nil {
 		return nil, err
 	}
 
-	return &registryResp{StatusCode: httpResp.StatusCode,
-		StatusString:  httpResp.Status,
-		Link:          httpResp.Header.Get("Link"),
-		Digest:        httpResp.Header.Get("Docker-Content-Digest"),
-		ContentLength: bodyLenth,
-		Body:          string(body)}, nil
+	if r.StatusCode != 401 {
+		return r, nil
+	}
+
+	challenge := parseAuthChallenge(r.Authenticate)
+	if challenge == nil {
+		return r, nil
+	}
+
+	switch challenge.Scheme {
+	case "basic":
+		if !c.hasCredentials() || c.isBasicAuth() {
+			return r, nil
+		}
+		closeBody(r)
+		c.tokenMutex.Lock()
+		c.basicAuth = true
+		c.tokenMutex.Unlock()
+
+	case "bearer":
+		closeBody(r)
+		// requests of one repo all get the same challenge, fetch its token once
+		_, err := c.flight.Do(ctx, "token "+key, func() (interface{}, error) {
+			return c.fetchToken(ctx, key, challenge)
+		})
+		if err != nil && isContextError(err) && ctx.Err() == nil {
+			_, err = c.fetchToken(ctx, key, challenge)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return r, nil
+	}
+
+	return c.sendRequest(ctx, method, path, headers, body, c.authorization(key))
 }
 
-func (c *RegistryClient) Ping() error {
-	if _, err := c.doRequest(http.MethodGet, "", nil); err != nil {
-		return err
+// sendRequest retries as c.retry allows, every attempt waits for the rate limiter first
+func (c *RegistryClient) sendRequest(ctx context.Context, method string, path string, headers map[string]string, body []byte, authorization string) (*registryResp, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		r, err := c.sendOnce(ctx, method, path, headers, body, authorization)
+		statusCode := 0
+		if r != nil {
+			c.updateRateLimit(r)
+			statusCode = r.StatusCode
+		}
+
+		if attempt >= c.retry.MaxRetries || !retryable(method, statusCode, err) {
+			return r, err
+		}
+		wait, ok := c.retry.backoff(attempt, r)
+		if !ok {
+			return r, err
+		}
+		if r != nil {
+			closeBody(r)
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
 	}
-	return nil
 }
 
-func (c *RegistryClient) GetTags(name string) ([]string, error) {
-	r, err := c.doRequest(http.MethodGet, name+"/tags/list", nil)
+// requestURL is the url of path under /v2/ of the registry. Absolute urls the registry gave us,
+// eg, upload locations and next page links, are used as they are
+func (c *RegistryClient) requestURL(path string) string {
+	if isAbsoluteURL(path) {
+		return path
+	}
+	// keep a trailing slash, upload urls end with one
+	return c.host + "/v2/" + strings.TrimLeft(path, "/\\")
+}
+
+func isAbsoluteURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// resolveLocation resolves a Location or Link header answering the request to from, with extra query params
+func (c *RegistryClient) resolveLocation(from string, location string, params map[string]string) (string, error) {
+	base, err := url.Parse(c.requestURL(from))
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	if len(params) > 0 {
+		query := u.Query()
+		for k, v := range params {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+func (c *RegistryClient) sendOnce(ctx context.Context, method string, path string, headers map[string]string, body []byte, authorization string) (*registryResp, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.requestURL(path), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 
-	if r.StatusCode == 404 {
-		return nil, ERR_IMAGE_NOT_FOUND
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+	// our credentials are for the registry only, not the other hosts it sends uploads to
+	if authorization != "" && c.isRegistryURL(req.URL) {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
 
-	if r.StatusCode != 200 {
-		return nil, errors.New(r.StatusString)
+	// the connection goes back to the pool only once Stream is read to the end and closed
+	return &registryResp{StatusCode: httpResp.StatusCode,
+		StatusString:       httpResp.Status,
+		Link:               httpResp.Header.Get("Link"),
+		Digest:             httpResp.Header.Get("Docker-Content-Digest"),
+		ContentType:        httpResp.Header.Get("Content-Type"),
+		Location:           httpResp.Header.Get("Location"),
+		Authenticate:       httpResp.Header.Get("WWW-Authenticate"),
+		RetryAfter:         httpResp.Header.Get("Retry-After"),
+		RateLimitLimit:     httpResp.Header.Get("RateLimit-Limit"),
+		RateLimitRemaining: httpResp.Header.Get("RateLimit-Remaining"),
+		RateLimitReset:     httpResp.Header.Get("RateLimit-Reset"),
+		ContentRange:       httpResp.Header.Get("Content-Range"),
+		ContentLength:      httpResp.ContentLength,
+		Stream:             httpResp.Body}, nil
+}
+
+func (c *RegistryClient) PingContext(ctx context.Context) error {
+	r, err := c.doRequest(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return err
 	}
 
-	var tags TagsResp
-	if err := json.Unmarshal([]byte(r.Body), &tags); err != nil {
-		return nil, errors.New("can not Unmarshal string\n\n" + r.Body + "\n\nerror: " + err.Error())
+	if r.StatusCode == 401 {
+		return newRegistryError(r)
 	}
 
-	return tags.Tags, nil
+	return nil
 }
 
-func (c *RegistryClient) GetManifestV1(name string, reference string) (*ManifestV1Resp, error) {
-	r, err := c.doRequest(http.MethodGet, name+"/manifests/"+reference, nil)
+// GetTagsContext follows pagination, see WalkTags to process tags page by page
+func (c *RegistryClient) GetTagsContext(ctx context.Context, name string) ([]string, error) {
+	tags := make([]string, 0, pageSize)
+	err := c.WalkTagsContext(ctx, name, func(page []string) error {
+		tags = append(tags, page...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if r.StatusCode == 404 {
-		return nil, ERR_IMAGE_NOT_FOUND
+	return tags, nil
+}
+
+func (c *RegistryClient) GetManifestV1Context(ctx context.Context, name string, reference string) (*ManifestV1Resp, error) {
+	r, err := c.doRequest(ctx, http.MethodGet, name+"/manifests/"+reference, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	if r.StatusCode != 200 {
-		return nil, errors.New(r.StatusString)
+		return nil, newRegistryError(r)
 	}
 
 	var manifest ManifestV1Resp
-	if err := json.Unmarshal([]byte(r.Body), &manifest); err != nil {
-		return nil, errors.New("can not Unmarshal string\n\n" + r.Body + "\n\nerror: " + err.Error())
+	if err := json.Unmarshal(r.Body, &manifest); err != nil {
+		return nil, errors.New("can not Unmarshal string\n\n" + string(r.Body) + "\n\nerror: " + err.Error())
 	}
 
 	manifest.Digest = r.Digest
@@ -160,26 +400,22 @@ func (c *RegistryClient) GetManifestV1(name string, reference string) (*Manifest
 	return &manifest, nil
 }
 
-func (c *RegistryClient) GetManifestV2(name string, reference string) (*ManifestV2Resp, error) {
+func (c *RegistryClient) GetManifestV2Context(ctx context.Context, name string, reference string) (*ManifestV2Resp, error) {
 	headers := make(map[string]string)
 	headers["Accept"] = "application/vnd.docker.distribution.manifest.v2+json"
 
-	r, err := c.doRequest(http.MethodGet, name+"/manifests/"+reference, headers)
+	r, err := c.doRequest(ctx, http.MethodGet, name+"/manifests/"+reference, headers)
 	if err != nil {
 		return nil, err
 	}
 
-	if r.StatusCode == 404 {
-		return nil, ERR_IMAGE_NOT_FOUND
-	}
-
 	if r.StatusCode != 200 {
-		return nil, errors.New(r.StatusString)
+		return nil, newRegistryError(r)
 	}
 
 	var manifest ManifestV2Resp
-	if err := json.Unmarshal([]byte(r.Body), &manifest); err != nil {
-		return nil, errors.New("can not Unmarshal string\n\n" + r.Body + "\n\nerror: " + err.Error())
+	if err := json.Unmarshal(r.Body, &manifest); err != nil {
+		return nil, errors.New("can not Unmarshal string\n\n" + string(r.Body) + "\n\nerror: " + err.Error())
 	}
 
 	manifest.Digest = r.Digest
@@ -187,133 +423,393 @@ func (c *RegistryClient) GetManifestV2(name string, reference string) (*Manifest
 	return &manifest, nil
 }
 
-func (c *RegistryClient) GetCatalog() ([]string, error) {
-	getLastRepoFromLink := func(link string) string {
-		// Link: </v2/_catalog?last=rtd&n=100>; rel="next"
-		for _, part := range strings.Split(link, ";") {
-			if strings.HasPrefix(part, "</v2/_catalog?") {
-				for _, param := range strings.Split(strings.Split(strings.TrimRight(part, ">"), "?")[1], "&") {
-					if strings.HasPrefix(param, "last=") {
-						return strings.Split(param, "=")[1]
-					}
-				}
+var manifestAccept = strings.Join([]string{
+	MediaTypeManifestV2,
+	MediaTypeManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeOCIIndex,
+	MediaTypeSignedManifestV1,
+	MediaTypeManifestV1,
+}, ", ")
+
+// GetManifestContext negotiates every manifest type we understand and decodes whichever one the registry serves
+// GetManifest of a digest reference is served from the cache when possible
+func (c *RegistryClient) GetManifestContext(ctx context.Context, name string, reference string) (*ManifestResp, error) {
+	m, _, err := c.getManifest(ctx, name, reference)
+	return m, err
+}
+
+// RawManifest is a manifest as the registry serves it, to push it elsewhere unchanged
+type RawManifest struct {
+	MediaType string
+	Digest    string
+	Body      []byte
+}
+
+func (raw *RawManifest) Decode() (*ManifestResp, error) {
+	return parseManifest(raw.MediaType, raw.Digest, raw.Body)
+}
+
+// GetRawManifestContext is GetManifestContext without decoding, MediaType is what the manifest turned out to be
+func (c *RegistryClient) GetRawManifestContext(ctx context.Context, name string, reference string) (*RawManifest, error) {
+	_, raw, err := c.getManifest(ctx, name, reference)
+	return raw, err
+}
+
+func (c *RegistryClient) getManifest(ctx context.Context, name string, reference string) (*ManifestResp, *RawManifest, error) {
+	if value, ok := c.cacheGet("manifest", reference); ok {
+		var cached cachedManifest
+		if err := json.Unmarshal(value, &cached); err == nil {
+			if m, err := parseManifest(cached.MediaType, reference, cached.Body); err == nil {
+				return m, &RawManifest{MediaType: m.MediaType, Digest: reference, Body: cached.Body}, nil
 			}
 		}
+	}
 
-		return ""
+	headers := make(map[string]string)
+	headers["Accept"] = manifestAccept
+
+	r, err := c.doRequest(ctx, http.MethodGet, name+"/manifests/"+reference, headers)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	repos := make([]string, 0, 100)
-	lastRepo := ""
-	for {
-		path := "_catalog?n=100"
-		if lastRepo != "" {
-			path += "&last=" + lastRepo
-		}
+	if r.StatusCode != 200 {
+		return nil, nil, newRegistryError(r)
+	}
 
-		r, err := c.doRequest(http.MethodGet, path, nil)
-		if err != nil {
-			return nil, err
-		}
+	m, err := parseManifest(r.ContentType, r.Digest, r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		if r.StatusCode != 200 {
-			return nil, errors.New(r.StatusString)
+	// only what matches its digest, signed schema1 manifests never do
+	if r.Digest != "" && digestOf(r.Body) == r.Digest {
+		if value, err := json.Marshal(cachedManifest{MediaType: m.MediaType, Body: r.Body}); err == nil {
+			c.cacheSet("manifest", r.Digest, value)
 		}
+	}
 
-		var catalog CatalogResp
-		if err := json.Unmarshal([]byte(r.Body), &catalog); err != nil {
-			return nil, errors.New("can not Unmarshal string\n\n" + r.Body + "\n\nerror: " + err.Error())
-		}
+	return m, &RawManifest{MediaType: m.MediaType, Digest: r.Digest, Body: r.Body}, nil
+}
 
-		repos = append(repos, catalog.Repositories...)
+func parseManifest(contentType string, digest string, body []byte) (*ManifestResp, error) {
+	var versioned struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		MediaType     string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(body, &versioned); err != nil {
+		return nil, errors.New("can not Unmarshal string\n\n" + string(body) + "\n\nerror: " + err.Error())
+	}
 
-		lastRepo = getLastRepoFromLink(r.Link)
-		if lastRepo == "" {
-			break
+	// old registries answer application/json, then trust the manifest itself
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	switch mediaType {
+	case MediaTypeManifestV1, MediaTypeSignedManifestV1, MediaTypeManifestV2, MediaTypeManifestList, MediaTypeOCIManifest, MediaTypeOCIIndex:
+	default:
+		mediaType = versioned.MediaType
+		if mediaType == "" && versioned.SchemaVersion == 1 {
+			mediaType = MediaTypeSignedManifestV1
 		}
 	}
 
+	m := &ManifestResp{MediaType: mediaType, Digest: digest}
+	var target interface{}
+	switch mediaType {
+	case MediaTypeManifestV1, MediaTypeSignedManifestV1:
+		m.V1 = &ManifestV1Resp{Digest: digest}
+		target = m.V1
+	case MediaTypeManifestV2:
+		m.V2 = &ManifestV2Resp{Digest: digest}
+		target = m.V2
+	case MediaTypeManifestList:
+		m.List = &ManifestListResp{Digest: digest}
+		target = m.List
+	case MediaTypeOCIManifest:
+		m.OCI = &OCIManifestResp{Digest: digest}
+		target = m.OCI
+	case MediaTypeOCIIndex:
+		m.OCIIndex = &OCIIndexResp{Digest: digest}
+		target = m.OCIIndex
+	default:
+		return nil, errors.New("unsupported manifest media type: " + mediaType)
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return nil, errors.New("can not Unmarshal string\n\n" + string(body) + "\n\nerror: " + err.Error())
+	}
+
+	return m, nil
+}
+
+// GetCatalogContext follows pagination, see WalkCatalog to process repositories page by page
+func (c *RegistryClient) GetCatalogContext(ctx context.Context) ([]string, error) {
+	repos := make([]string, 0, pageSize)
+	err := c.WalkCatalogContext(ctx, func(page []string) error {
+		repos = append(repos, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return repos, nil
 }
 
-func (c *RegistryClient) deleteByDigest(name string, digest string) error {
+func (c *RegistryClient) deleteByDigest(ctx context.Context, name string, digest string) error {
 	headers := make(map[string]string)
 	headers["Accept"] = "application/vnd.docker.distribution.manifest.v2+json"
 
-	r, err := c.doRequest(http.MethodDelete, name+"/manifests/"+digest, headers)
+	r, err := c.doRequest(ctx, http.MethodDelete, name+"/manifests/"+digest, headers)
 	if err != nil {
 		return err
 	}
 
 	if r.StatusCode != 202 {
-		if r.Body != "" {
-			return errors.New(r.Body)
-		}
-		return errors.New(r.StatusString)
+		return newRegistryError(r)
 	}
 
 	return nil
 }
 
-func (c *RegistryClient) DeleteTag(name string, tag string) error {
-	m, err := c.GetManifestV2(name, tag)
+// DeleteManifestContext deletes digest from repository name, every tag pointing at it is gone too
+func (c *RegistryClient) DeleteManifestContext(ctx context.Context, name string, digest string) error {
+	return c.deleteByDigest(ctx, name, digest)
+}
+
+func (c *RegistryClient) DeleteTagContext(ctx context.Context, name string, tag string) error {
+	m, err := c.GetManifestContext(ctx, name, tag)
 	if err != nil {
-		return errors.New("can not get image[" + name + ":" + tag + "] digest for delete, error: " + err.Error())
+		return fmt.Errorf("can not get image[%s:%s] digest for delete, error: %w", name, tag, err)
 	}
 
-	return c.deleteByDigest(name, m.Digest)
+	return c.deleteByDigest(ctx, name, m.Digest)
 }
 
-func (c *RegistryClient) getBlobSize(name string, digest string) (uint64, error) {
-	if size, ok := c.blobSizeMap[digest]; ok {
+func (c *RegistryClient) getBlobSize(ctx context.Context, name string, digest string) (uint64, error) {
+	if size, ok := c.cachedBlobSize(digest); ok {
 		return size, nil
 	}
 
-	r, err := c.doRequest(http.MethodHead, name+"/blobs/"+digest, nil)
+	r, err := c.doRequest(ctx, http.MethodHead, name+"/blobs/"+digest, nil)
 	if err != nil {
 		return 0, err
 	}
 
-	if r.StatusCode == 404 {
-		return 0, ERR_IMAGE_NOT_FOUND
-	}
-
 	if r.StatusCode != 200 {
-		return 0, errors.New(r.StatusString)
+		return 0, newRegistryError(r)
 	}
 
-	c.blobSizeMap[digest] = r.ContentLength
-	return r.ContentLength, nil
+	if r.ContentLength < 0 {
+		return 0, errors.New("registry did not send the size of blob " + digest)
+	}
+	size := uint64(r.ContentLength)
+	c.cacheSet("blobsize", digest, []byte(strconv.FormatUint(size, 10)))
+	return size, nil
 }
 
-func (c *RegistryClient) GetImageInfo(name string, tag string) (*ImageInfo, error) {
-	mV1, err := c.GetManifestV1(name, tag)
+func (c *RegistryClient) GetImageInfoContext(ctx context.Context, name string, tag string) (*ImageInfo, error) {
+	m, err := c.GetManifestContext(ctx, name, tag)
 	if err != nil {
-		return nil, errors.New("can not get image[" + name + ":" + tag + "] manifest(V1), error: " + err.Error())
+		return nil, fmt.Errorf("can not get image[%s:%s] manifest, error: %w", name, tag, err)
 	}
 
-	if len(mV1.FSLayers) == 0 || len(mV1.Historys) == 0 || len(mV1.FSLayers) != len(mV1.Historys) {
-		return nil, errors.New("invalid manifest(V1), empty layers or history or not equal numbers")
+	return c.imageInfo(ctx, name, tag, m)
+}
+
+func (c *RegistryClient) imageInfo(ctx context.Context, name string, tag string, m *ManifestResp) (*ImageInfo, error) {
+	var info ImageInfo
+	info.Name = name
+	info.Tag = tag
+	info.MediaType = m.MediaType
+	info.DigestV2 = m.Digest
+
+	switch {
+	case m.V1 != nil:
+		info.DigestV2 = ""
+		if err := c.fillImageInfoV1(ctx, &info, m.V1); err != nil {
+			return nil, err
+		}
+
+	case m.V2 != nil || m.OCI != nil:
+		var config *ImageConfig
+		// artifacts (helm charts, signatures...) carry configs that are not image configs
+		if mediaType := m.Config().MediaType; mediaType == MediaTypeImageConfig || mediaType == MediaTypeOCIImageConfig {
+			var err error
+			if config, err = c.GetImageConfigContext(ctx, name, m.Config().Digest); err != nil {
+				return nil, fmt.Errorf("can not get image[%s:%s] config, error: %w", name, tag, err)
+			}
+		}
+		fillImageInfoConfig(&info, m.Layers(), config)
+
+	case m.List != nil || m.OCIIndex != nil:
+		info.Platforms = c.getPlatforms(ctx, name, m)
+		for _, platform := range info.Platforms {
+			info.Size += platform.Size
+		}
 	}
+	info.HumanSize = HumanSize(info.Size)
+
+	return &info, nil
+}
+
+// MatchLabels reports whether info has every label of selectors, a selector is "key=value" or just "key"
+func (info *ImageInfo) MatchLabels(selectors []string) bool {
+	for _, selector := range selectors {
+		if selector == "" {
+			continue
+		}
 
-	mV2, err := c.GetManifestV2(name, tag)
+		parts := strings.SplitN(selector, "=", 2)
+		value, ok := info.Labels[parts[0]]
+		if !ok {
+			return false
+		}
+		if len(parts) == 2 && parts[1] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SortedLabelKeys gives the keys of Labels in a stable order for printing
+func (info *ImageInfo) SortedLabelKeys() []string {
+	keys := make([]string, 0, len(info.Labels))
+	for k := range info.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Kind is a short name of MediaType for display
+func (info *ImageInfo) Kind() string {
+	switch info.MediaType {
+	case MediaTypeManifestV1, MediaTypeSignedManifestV1:
+		return "docker v1"
+	case MediaTypeManifestV2:
+		return "docker v2"
+	case MediaTypeManifestList:
+		return "manifest list"
+	case MediaTypeOCIManifest:
+		return "oci"
+	case MediaTypeOCIIndex:
+		return "oci index"
+	}
+	return info.MediaType
+}
+
+func (c *RegistryClient) GetImageConfigContext(ctx context.Context, name string, digest string) (*ImageConfig, error) {
+	if value, ok := c.cacheGet("config", digest); ok {
+		var config ImageConfig
+		if err := json.Unmarshal(value, &config); err == nil {
+			return &config, nil
+		}
+	}
+
+	r, err := c.doRequest(ctx, http.MethodGet, name+"/blobs/"+digest, nil)
 	if err != nil {
-		return nil, errors.New("can not get image[" + name + ":" + tag + "] manifest(V2), error: " + err.Error())
+		return nil, err
+	}
+
+	if r.StatusCode != 200 {
+		return nil, newRegistryError(r)
+	}
+
+	var config ImageConfig
+	if err := json.Unmarshal(r.Body, &config); err != nil {
+		return nil, errors.New("can not Unmarshal string\n\n" + string(r.Body) + "\n\nerror: " + err.Error())
+	}
+
+	if digestOf(r.Body) == digest {
+		c.cacheSet("config", digest, r.Body)
 	}
 
-	/*
-		if len(mV2.Layers) != len(mV1.FSLayers) {
-			return nil, errors.New("invalid manifest(V2), layers number of v1 and v2 not equal")
+	return &config, nil
+}
+
+// fillImageInfoConfig fills info from the layers of a schema2/oci manifest and its config, config may be nil
+func fillImageInfoConfig(info *ImageInfo, layers []V2Layer, config *ImageConfig) {
+	var history []ConfigHistory
+	if config != nil {
+		info.DockerVersion = config.DockerVersion
+		info.CreatedTime = config.Created
+		info.OS = config.OS
+		info.Architecture = config.Architecture
+		info.Variant = config.Variant
+
+		for k, _ := range config.Config.ExposedPorts {
+			info.ExposedPorts = append(info.ExposedPorts, k)
 		}
-	*/
+		sort.Strings(info.ExposedPorts)
+
+		info.Envs = config.Config.Envs
+		info.Cmd = strings.Join(config.Config.Cmds, ", ")
+
+		for k, _ := range config.Config.Volumes {
+			info.Volumes = append(info.Volumes, k)
+		}
+		sort.Strings(info.Volumes)
+
+		info.WorkingDir = config.Config.WorkingDir
+		info.Entrypoint = strings.Join(config.Config.Entrypoint, ", ")
+		info.Author = config.Author
+		fillImageInfoContainerConfig(info, &config.Config)
+
+		history = config.History
+	}
+
+	// history covers every build step, only those without empty_layer own the next manifest layer
+	var all []ImageLayer
+	next := 0
+	for _, h := range history {
+		var layer ImageLayer
+		layer.CreatedTime = h.Created
+		layer.Cmd = h.CreatedBy
+		layer.Comment = h.Comment
+		layer.EmptyLayer = h.EmptyLayer
+
+		if !h.EmptyLayer && next < len(layers) {
+			layer.BlobSum = layers[next].Digest
+			layer.Size = layers[next].Size
+			next++
+		}
+		layer.HumanSize = HumanSize(layer.Size)
+
+		all = append(all, layer)
+	}
+	// no or short history, still show the layers
+	for ; next < len(layers); next++ {
+		all = append(all, ImageLayer{BlobSum: layers[next].Digest, Size: layers[next].Size, HumanSize: HumanSize(layers[next].Size)})
+	}
+
+	// base first in manifest and config, list them newest first like schema1 does
+	for index := len(all) - 1; index >= 0; index-- {
+		info.Layers = append(info.Layers, all[index])
+		info.Size += all[index].Size
+	}
+}
+
+func fillImageInfoContainerConfig(info *ImageInfo, config *V1Config) {
+	info.User = config.User
+	info.Labels = config.Labels
+	info.StopSignal = config.StopSignal
+	info.StopTimeout = config.StopTimeout
+	info.Healthcheck = config.Healthcheck
+	info.Shell = strings.Join(config.Shell, ", ")
+	info.ArgsEscaped = config.ArgsEscaped
+	info.OnBuild = config.OnBuild
+}
+
+func (c *RegistryClient) fillImageInfoV1(ctx context.Context, info *ImageInfo, mV1 *ManifestV1Resp) error {
+	if len(mV1.FSLayers) == 0 || len(mV1.Historys) == 0 || len(mV1.FSLayers) != len(mV1.Historys) {
+		return errors.New("invalid manifest(V1), empty layers or history or not equal numbers")
+	}
 
-	var info ImageInfo
-	info.Name = name
-	info.Tag = tag
 	info.DockerVersion = mV1.Historys[0].V1Compatibility.DockerVersion
 	info.CreatedTime = mV1.Historys[0].V1Compatibility.CreatedTime
 	info.DigestV1 = mV1.Digest
-	info.DigestV2 = mV2.Digest
 
 	for k, _ := range mV1.Historys[0].V1Compatibility.Config.ExposedPorts {
 		info.ExposedPorts = append(info.ExposedPorts, k)
@@ -328,6 +824,8 @@ func (c *RegistryClient) GetImageInfo(name string, tag string) (*ImageInfo, erro
 
 	info.WorkingDir = mV1.Historys[0].V1Compatibility.Config.WorkingDir
 	info.Entrypoint = strings.Join(mV1.Historys[0].V1Compatibility.Config.Entrypoint, ", ")
+	info.Author = mV1.Historys[0].V1Compatibility.Author
+	fillImageInfoContainerConfig(info, &mV1.Historys[0].V1Compatibility.Config)
 
 	//mV1.FSLayers 是有顺序的，时间倒序
 	for index, _ := range mV1.FSLayers {
@@ -337,22 +835,12 @@ func (c *RegistryClient) GetImageInfo(name string, tag string) (*ImageInfo, erro
 		layer.Cmd = strings.Join(mV1.Historys[index].V1Compatibility.ContainerConfig.Cmds, ", ")
 
 		//v1中的blobsum在v2中不一定有，所以还是取v1中blob的length
-		/*
-			for _, v2layer := range mV2.Layers {
-				if v2layer.Digest == layer.BlobSum {
-					layer.Size = v2layer.Size
-					layer.HumanSize = humanSize(layer.Size)
-					break
-				}
-			}
-		*/
-		layer.Size, _ = c.getBlobSize(info.Name, layer.BlobSum)
-		layer.HumanSize = humanSize(layer.Size)
+		layer.Size, _ = c.getBlobSize(ctx, info.Name, layer.BlobSum)
+		layer.HumanSize = HumanSize(layer.Size)
 
 		info.Layers = append(info.Layers, layer)
 		info.Size += layer.Size
 	}
-	info.HumanSize = humanSize(info.Size)
 
-	return &info, nil
+	return nil
 }
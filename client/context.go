@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"io"
+)
+
+// Methods without a context use context.Background(), the XxxContext ones are canceled with their ctx
+
+func (c *RegistryClient) Ping() error {
+	return c.PingContext(context.Background())
+}
+
+func (c *RegistryClient) GetTags(name string) ([]string, error) {
+	return c.GetTagsContext(context.Background(), name)
+}
+
+func (c *RegistryClient) GetManifestV1(name string, reference string) (*ManifestV1Resp, error) {
+	return c.GetManifestV1Context(context.Background(), name, reference)
+}
+
+func (c *RegistryClient) GetManifestV2(name string, reference string) (*ManifestV2Resp, error) {
+	return c.GetManifestV2Context(context.Background(), name, reference)
+}
+
+func (c *RegistryClient) GetManifest(name string, reference string) (*ManifestResp, error) {
+	return c.GetManifestContext(context.Background(), name, reference)
+}
+
+func (c *RegistryClient) GetCatalog() ([]string, error) {
+	return c.GetCatalogContext(context.Background())
+}
+
+func (c *RegistryClient) DeleteManifest(name string, digest string) error {
+	return c.DeleteManifestContext(context.Background(), name, digest)
+}
+
+func (c *RegistryClient) DeleteTag(name string, tag string) error {
+	return c.DeleteTagContext(context.Background(), name, tag)
+}
+
+func (c *RegistryClient) GetImageInfo(name string, tag string) (*ImageInfo, error) {
+	return c.GetImageInfoContext(context.Background(), name, tag)
+}
+
+func (c *RegistryClient) GetImageConfig(name string, digest string) (*ImageConfig, error) {
+	return c.GetImageConfigContext(context.Background(), name, digest)
+}
+
+func (c *RegistryClient) GetPlatformImageInfo(name string, tag string, platform string) (*ImageInfo, error) {
+	return c.GetPlatformImageInfoContext(context.Background(), name, tag, platform)
+}
+
+func (c *RegistryClient) GetDigest(name string, reference string) (string, error) {
+	return c.GetDigestContext(context.Background(), name, reference)
+}
+
+func (c *RegistryClient) TagsWithDigest(name string, digest string) ([]string, error) {
+	return c.TagsWithDigestContext(context.Background(), name, digest)
+}
+
+func (c *RegistryClient) TagsSharingDigest(name string, tag string) (string, []string, error) {
+	return c.TagsSharingDigestContext(context.Background(), name, tag)
+}
+
+func (c *RegistryClient) UntagTag(name string, tag string) error {
+	return c.UntagTagContext(context.Background(), name, tag)
+}
+
+func (c *RegistryClient) WalkTags(name string, fn func(tags []string) error) error {
+	return c.WalkTagsContext(context.Background(), name, fn)
+}
+
+func (c *RegistryClient) WalkCatalog(fn func(repos []string) error) error {
+	return c.WalkCatalogContext(context.Background(), fn)
+}
+
+func (c *RegistryClient) GetBlob(name string, digest string) (io.ReadCloser, int64, error) {
+	return c.GetBlobContext(context.Background(), name, digest)
+}
+
+func (c *RegistryClient) DownloadBlob(name string, digest string, size int64, w io.Writer) (int64, error) {
+	return c.DownloadBlobContext(context.Background(), name, digest, size, w)
+}
+
+func (c *RegistryClient) ResumeBlob(name string, digest string, size int64, partial io.Reader, w io.Writer) (int64, error) {
+	return c.ResumeBlobContext(context.Background(), name, digest, size, partial, w)
+}
+
+func (c *RegistryClient) GetRawManifest(name string, reference string) (*RawManifest, error) {
+	return c.GetRawManifestContext(context.Background(), name, reference)
+}
+
+func (c *RegistryClient) BlobExists(name string, digest string) (bool, int64, error) {
+	return c.BlobExistsContext(context.Background(), name, digest)
+}
+
+func (c *RegistryClient) PushBlob(name string, data []byte) (string, error) {
+	return c.PushBlobContext(context.Background(), name, data)
+}
+
+func (c *RegistryClient) PushBlobChunked(name string, digest string, r io.Reader, chunkSize int) (string, error) {
+	return c.PushBlobChunkedContext(context.Background(), name, digest, r, chunkSize)
+}
+
+func (c *RegistryClient) MountBlob(name string, from string, digest string) (bool, error) {
+	return c.MountBlobContext(context.Background(), name, from, digest)
+}
+
+func (c *RegistryClient) PutManifest(name string, reference string, mediaType string, body []byte) (string, error) {
+	return c.PutManifestContext(context.Background(), name, reference, mediaType, body)
+}
@@ -0,0 +1,169 @@
+// Reference: https://docs.docker.com/engine/reference/commandline/login/#credentials-store
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// docker stores identity tokens under this username, the secret is then an oauth2 refresh token
+const identityTokenUsername = "<token>"
+
+type DockerConfig struct {
+	Auths       map[string]DockerAuthConfig `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+type DockerAuthConfig struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+type credentialHelperResp struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// DefaultDockerConfigPath follows docker: $DOCKER_CONFIG/config.json, then ~/.docker/config.json
+func DefaultDockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+
+	home := os.Getenv("HOME")
+	if home == "" {
+		u, err := user.Current()
+		if err != nil {
+			return ""
+		}
+		home = u.HomeDir
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// LoadDockerCredentials returns what `docker login` stored for registry (host[:port]).
+// A missing config file or registry entry is not an error, it returns empty credentials.
+// Registries without an auths entry are still looked up in credsStore, docker does not always write one
+func LoadDockerCredentials(configPath string, registry string) (string, string, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+
+	var config DockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", "", errors.New("can not parse docker config[" + configPath + "], error: " + err.Error())
+	}
+
+	serverURL := registry
+	registry = normalizeRegistryKey(registry)
+
+	for key, helper := range config.CredHelpers {
+		if normalizeRegistryKey(key) == registry {
+			return runCredentialHelper(helper, key)
+		}
+	}
+
+	for key, auth := range config.Auths {
+		if normalizeRegistryKey(key) != registry {
+			continue
+		}
+
+		if auth.IdentityToken != "" {
+			return identityTokenUsername, auth.IdentityToken, nil
+		}
+
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return "", "", errors.New("invalid auth of [" + key + "] in docker config, error: " + err.Error())
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return "", "", errors.New("invalid auth of [" + key + "] in docker config, expect username:password")
+			}
+			return parts[0], parts[1], nil
+		}
+
+		if auth.Username != "" {
+			return auth.Username, auth.Password, nil
+		}
+
+		// an empty entry means the secret is kept by credsStore
+		if config.CredsStore != "" {
+			return runCredentialHelper(config.CredsStore, key)
+		}
+	}
+
+	if config.CredsStore != "" {
+		// docker logs in to Docker Hub under its v1 url
+		if registry == "index.docker.io" {
+			serverURL = "https://index.docker.io/v1/"
+		}
+		// nothing says the registry needs credentials, eg, a config copied without its helper,
+		// go on without them rather than fail
+		username, password, err := runCredentialHelper(config.CredsStore, serverURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning: no credentials for "+serverURL+" from credsStore, error: "+err.Error())
+			return "", "", nil
+		}
+		return username, password, nil
+	}
+
+	return "", "", nil
+}
+
+func runCredentialHelper(helper string, serverURL string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		// helpers print "credentials not found in native keychain" when there is nothing stored
+		if strings.Contains(string(out)+stderr.String(), "credentials not found") {
+			return "", "", nil
+		}
+		return "", "", errors.New("docker-credential-" + helper + " fail, error: " + err.Error() + ", " + strings.TrimSpace(string(out)+stderr.String()))
+	}
+
+	var resp credentialHelperResp
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return "", "", errors.New("can not Unmarshal docker-credential-" + helper + " output, error: " + err.Error())
+	}
+
+	return resp.Username, resp.Secret, nil
+}
+
+// normalizeRegistryKey maps "https://example.com:5000/v1/" and "example.com:5000" to the same key
+func normalizeRegistryKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	if index := strings.Index(key, "/"); index >= 0 {
+		key = key[:index]
+	}
+
+	switch key {
+	case "docker.io", "registry-1.docker.io", "index.docker.io":
+		return "index.docker.io"
+	}
+
+	return key
+}
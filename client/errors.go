@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// ErrorCode is a code of the registry error payload, https://distribution.github.io/distribution/spec/api/#errors-2
+// Check them with errors.Is(err, client.ERR_MANIFEST_UNKNOWN)
+type ErrorCode string
+
+const (
+	ERR_BLOB_UNKNOWN          ErrorCode = "BLOB_UNKNOWN"
+	ERR_BLOB_UPLOAD_INVALID   ErrorCode = "BLOB_UPLOAD_INVALID"
+	ERR_BLOB_UPLOAD_UNKNOWN   ErrorCode = "BLOB_UPLOAD_UNKNOWN"
+	ERR_DIGEST_INVALID        ErrorCode = "DIGEST_INVALID"
+	ERR_MANIFEST_BLOB_UNKNOWN ErrorCode = "MANIFEST_BLOB_UNKNOWN"
+	ERR_MANIFEST_INVALID      ErrorCode = "MANIFEST_INVALID"
+	ERR_MANIFEST_UNKNOWN      ErrorCode = "MANIFEST_UNKNOWN"
+	ERR_MANIFEST_UNVERIFIED   ErrorCode = "MANIFEST_UNVERIFIED"
+	ERR_NAME_INVALID          ErrorCode = "NAME_INVALID"
+	ERR_NAME_UNKNOWN          ErrorCode = "NAME_UNKNOWN"
+	ERR_SIZE_INVALID          ErrorCode = "SIZE_INVALID"
+	ERR_TAG_INVALID           ErrorCode = "TAG_INVALID"
+	ERR_UNAUTHORIZED          ErrorCode = "UNAUTHORIZED"
+	ERR_DENIED                ErrorCode = "DENIED"
+	ERR_UNSUPPORTED           ErrorCode = "UNSUPPORTED"
+	ERR_TOOMANYREQUESTS       ErrorCode = "TOOMANYREQUESTS"
+	ERR_UNKNOWN               ErrorCode = "UNKNOWN"
+
+	// not a registry code, matches any 404 whatever code the registry sent, if any
+	ERR_NOT_FOUND ErrorCode = "NOT_FOUND"
+)
+
+func (code ErrorCode) Error() string {
+	return strings.ToLower(strings.Replace(string(code), "_", " ", -1))
+}
+
+type ErrorDetail struct {
+	Code    ErrorCode       `json:"code"`
+	Message string          `json:"message"`
+	Detail  json.RawMessage `json:"detail,omitempty"`
+}
+
+// RegistryError is a non-2xx registry response
+type RegistryError struct {
+	StatusCode int
+	Status     string
+	Errors     []ErrorDetail
+	// how long the registry asked us to wait, zero when it did not say
+	RetryAfter time.Duration
+}
+
+// newRegistryError decodes the error payload of r, registries answering HEAD or plain text leave Errors empty.
+// An open Stream is read up to maxDrainSize and closed
+func newRegistryError(r *registryResp) *RegistryError {
+	e := &RegistryError{StatusCode: r.StatusCode, Status: r.StatusString}
+	e.RetryAfter, _ = retryAfter(r, time.Now())
+
+	body := r.Body
+	if r.Stream != nil {
+		body, _ = ioutil.ReadAll(io.LimitReader(r.Stream, maxDrainSize))
+		closeBody(r)
+	}
+
+	var payload struct {
+		Errors []ErrorDetail `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		e.Errors = payload.Errors
+	}
+	for i := range e.Errors {
+		if string(e.Errors[i].Detail) == "null" {
+			e.Errors[i].Detail = nil
+		}
+	}
+
+	return e
+}
+
+// Code is the first code of the payload, or guessed from the status when there is none
+func (e *RegistryError) Code() ErrorCode {
+	if len(e.Errors) > 0 && e.Errors[0].Code != "" {
+		return e.Errors[0].Code
+	}
+
+	switch e.StatusCode {
+	case 401:
+		return ERR_UNAUTHORIZED
+	case 403:
+		return ERR_DENIED
+	case 404:
+		return ERR_NOT_FOUND
+	case 405:
+		return ERR_UNSUPPORTED
+	case 429:
+		return ERR_TOOMANYREQUESTS
+	}
+	return ERR_UNKNOWN
+}
+
+func (e *RegistryError) Error() string {
+	if len(e.Errors) == 0 {
+		return string(e.Code()) + ": " + e.Status
+	}
+
+	messages := make([]string, 0, len(e.Errors))
+	for _, d := range e.Errors {
+		message := string(d.Code)
+		if d.Message != "" {
+			message += ": " + d.Message
+		}
+		messages = append(messages, message)
+	}
+	return strings.Join(messages, "; ") + " (" + e.Status + ")"
+}
+
+// Is matches any code of the payload, the code guessed from the status, and ERR_NOT_FOUND on 404
+func (e *RegistryError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	if !ok {
+		return false
+	}
+
+	if code == ERR_NOT_FOUND && e.StatusCode == 404 {
+		return true
+	}
+	for _, d := range e.Errors {
+		if d.Code == code {
+			return true
+		}
+	}
+	return e.Code() == code
+}
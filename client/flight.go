@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup lets concurrent callers asking for the same key share one call,
+// e.g. every tag of a repo HEADing the same base layer
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// Do runs fn, or waits for the call of key already running. A waiter gives up when its own ctx is done,
+// fn itself runs with the context of the first caller
+func (g *flightGroup) Do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mutex.Unlock()
+		select {
+		case <-call.done:
+			return call.val, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mutex.Unlock()
+
+	call.val, call.err = fn()
+	close(call.done)
+
+	g.mutex.Lock()
+	delete(g.calls, key)
+	g.mutex.Unlock()
+
+	return call.val, call.err
+}
@@ -14,7 +14,8 @@ const (
 	s_TERABYTE = 1024 * s_GIGABYTE
 )
 
-func humanSize(bytes uint64) string {
+// HumanSize formats bytes like 1.5M
+func HumanSize(bytes uint64) string {
 	unit := ""
 	value := float32(bytes)
 
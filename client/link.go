@@ -0,0 +1,88 @@
+package client
+
+import (
+	"strings"
+)
+
+// Link is one target of a Link header, RFC 5988
+type Link struct {
+	URL    string
+	Params map[string]string
+}
+
+// ParseLinks parses a Link header like
+//
+//	</v2/_catalog?last=rtd&n=100>; rel="next", <https://example.com/>; rel="prev"
+//
+// malformed links are skipped
+func ParseLinks(header string) []Link {
+	var links []Link
+	for len(header) > 0 {
+		start := strings.IndexByte(header, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(header[start:], '>')
+		if end < 0 {
+			break
+		}
+
+		link := Link{URL: header[start+1 : start+end], Params: make(map[string]string)}
+		header = header[start+end+1:]
+
+		// params up to the comma starting the next link, commas may be quoted
+		for {
+			header = strings.TrimLeft(header, " \t")
+			if !strings.HasPrefix(header, ";") {
+				break
+			}
+			header = strings.TrimLeft(header[1:], " \t")
+
+			i := strings.IndexAny(header, "=;,")
+			if i < 0 {
+				i = len(header)
+			}
+			key := strings.ToLower(strings.TrimSpace(header[:i]))
+			header = header[i:]
+
+			value := ""
+			if strings.HasPrefix(header, "=") {
+				header = strings.TrimLeft(header[1:], " \t")
+				if strings.HasPrefix(header, `"`) {
+					j := strings.IndexByte(header[1:], '"')
+					if j < 0 {
+						value, header = header[1:], ""
+					} else {
+						value, header = header[1:j+1], header[j+2:]
+					}
+				} else {
+					j := strings.IndexAny(header, ";,")
+					if j < 0 {
+						j = len(header)
+					}
+					value = strings.TrimSpace(header[:j])
+					header = header[j:]
+				}
+			}
+			if key != "" {
+				link.Params[key] = value
+			}
+		}
+
+		links = append(links, link)
+	}
+
+	return links
+}
+
+// nextLink returns the url of rel="next" in a Link header, rel may hold several space separated types
+func nextLink(header string) string {
+	for _, link := range ParseLinks(header) {
+		for _, rel := range strings.Fields(link.Params["rel"]) {
+			if strings.ToLower(rel) == "next" {
+				return link.URL
+			}
+		}
+	}
+	return ""
+}
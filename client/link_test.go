@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []Link
+	}{
+		{"", nil},
+		{`</v2/_catalog?last=rtd&n=100>; rel="next"`,
+			[]Link{{URL: "/v2/_catalog?last=rtd&n=100", Params: map[string]string{"rel": "next"}}}},
+		{`</v2/_catalog?last=rtd&n=100>; rel="next", <https://example.com/>; rel="prev"`,
+			[]Link{{URL: "/v2/_catalog?last=rtd&n=100", Params: map[string]string{"rel": "next"}},
+				{URL: "https://example.com/", Params: map[string]string{"rel": "prev"}}}},
+		{`<a>;rel=next;title="x, y; z", <b>; REL=prev`,
+			[]Link{{URL: "a", Params: map[string]string{"rel": "next", "title": "x, y; z"}},
+				{URL: "b", Params: map[string]string{"rel": "prev"}}}},
+		{`<a>; crossorigin`, []Link{{URL: "a", Params: map[string]string{"crossorigin": ""}}}},
+		{`<a; rel="next"`, nil},
+	}
+
+	for _, test := range tests {
+		if got := ParseLinks(test.header); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseLinks(%q) = %+v, want %+v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{`</v2/x/tags/list?last=a&n=1>; rel="next"`, "/v2/x/tags/list?last=a&n=1"},
+		{`<https://example.com/v2/x/tags/list?last=a>; rel="prev", <https://example.com/v2/x/tags/list?last=b>; rel="next"`,
+			"https://example.com/v2/x/tags/list?last=b"},
+		{`</v2/x/tags/list?last=a>; rel="Next last"`, "/v2/x/tags/list?last=a"},
+		{`</v2/x/tags/list?last=a>; rel="prev"`, ""},
+	}
+
+	for _, test := range tests {
+		if got := nextLink(test.header); got != test.want {
+			t.Errorf("nextLink(%q) = %q, want %q", test.header, got, test.want)
+		}
+	}
+}
+
+func TestResolveLocation(t *testing.T) {
+	c, err := NewRegistryClient("https", "registry.example.com/prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from     string
+		location string
+		params   map[string]string
+		want     string
+	}{
+		{"x/tags/list?n=100", "/prefix/v2/x/tags/list?last=a&n=100", nil,
+			"https://registry.example.com/prefix/v2/x/tags/list?last=a&n=100"},
+		{"x/tags/list?n=100", "list?last=a&n=100", nil,
+			"https://registry.example.com/prefix/v2/x/tags/list?last=a&n=100"},
+		{"x/tags/list?n=100", "https://mirror.example.com/v2/x/tags/list?last=a", nil,
+			"https://mirror.example.com/v2/x/tags/list?last=a"},
+		{"x/blobs/uploads/", "/prefix/v2/x/blobs/uploads/0f3a?_state=s", map[string]string{"digest": "sha256:ab12"},
+			"https://registry.example.com/prefix/v2/x/blobs/uploads/0f3a?_state=s&digest=sha256%3Aab12"},
+		{"https://storage.example.com/up/1", "https://storage.example.com/up/1?_state=s", nil,
+			"https://storage.example.com/up/1?_state=s"},
+	}
+
+	for _, test := range tests {
+		got, err := c.resolveLocation(test.from, test.location, test.params)
+		if err != nil || got != test.want {
+			t.Errorf("resolveLocation(%q, %q) = %q, %v, want %q", test.from, test.location, got, err, test.want)
+		}
+	}
+}
+
+func TestWalkTagsFollowsLinks(t *testing.T) {
+	pages := map[string][]string{"": {"a", "b"}, "b": {"c"}, "c": {"d"}}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last := r.URL.Query().Get("last")
+		tags, ok := pages[last]
+		if r.URL.Path != "/v2/x/tags/list" || !ok {
+			w.WriteHeader(404)
+			return
+		}
+
+		switch last {
+		case "":
+			// relative to the request
+			w.Header().Set("Link", `</v2/x/tags/list?last=b&n=2>; rel="next"`)
+		case "b":
+			// absolute
+			w.Header().Set("Link", `<`+srv.URL+`/v2/x/tags/list?last=c&n=2>; rel="next"`)
+		}
+		json.NewEncoder(w).Encode(TagsResp{Name: "x", Tags: tags})
+	}))
+	defer srv.Close()
+
+	c, err := NewRegistryClient("http", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := c.GetTagsContext(context.Background(), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("GetTags = %v, want %v", tags, want)
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type PlatformInfo struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	OSVersion    string `json:"osVersion,omitempty"`
+	MediaType    string `json:"mediaType"`
+	Digest       string `json:"digest"`
+	Size         uint64 `json:"size"`
+	HumanSize    string `json:"humanSize"`
+}
+
+// String formats the platform the way docker's --platform flag takes it, e.g. linux/arm64/v8
+func (p PlatformInfo) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Match reports whether p is what platform (os/arch[/variant]) asks for, variant is optional
+func (p PlatformInfo) Match(platform string) bool {
+	parts := strings.Split(strings.ToLower(strings.Trim(platform, "/")), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return false
+	}
+
+	if parts[0] != p.OS || parts[1] != p.Architecture {
+		return false
+	}
+
+	return len(parts) == 2 || parts[2] == p.Variant
+}
+
+// getPlatforms lists the images of a manifest list or oci index, with size of each image's layers
+func (c *RegistryClient) getPlatforms(ctx context.Context, name string, m *ManifestResp) []PlatformInfo {
+	var platforms []PlatformInfo
+	for _, desc := range m.Manifests() {
+		var platform PlatformInfo
+		if desc.Platform != nil {
+			platform.OS = desc.Platform.OS
+			platform.Architecture = desc.Platform.Architecture
+			platform.Variant = desc.Platform.Variant
+			platform.OSVersion = desc.Platform.OSVersion
+		}
+
+		// buildkit stores attestations as unknown/unknown entries of the index
+		if platform.OS == "unknown" || desc.Annotations["vnd.docker.reference.type"] == "attestation-manifest" {
+			continue
+		}
+
+		platform.MediaType = desc.MediaType
+		platform.Digest = desc.Digest
+		if child, err := c.GetManifestContext(ctx, name, desc.Digest); err == nil {
+			for _, layer := range child.Layers() {
+				platform.Size += layer.Size
+			}
+		}
+		platform.HumanSize = HumanSize(platform.Size)
+
+		platforms = append(platforms, platform)
+	}
+
+	return platforms
+}
+
+// GetPlatformImageInfoContext is GetImageInfo of one platform (os/arch[/variant]) when tag is a manifest list or oci index.
+// Single platform images are returned as is.
+func (c *RegistryClient) GetPlatformImageInfoContext(ctx context.Context, name string, tag string, platform string) (*ImageInfo, error) {
+	if platform == "" {
+		return c.GetImageInfoContext(ctx, name, tag)
+	}
+
+	m, err := c.GetManifestContext(ctx, name, tag)
+	if err != nil {
+		return nil, fmt.Errorf("can not get image[%s:%s] manifest, error: %w", name, tag, err)
+	}
+
+	if m.List == nil && m.OCIIndex == nil {
+		return c.imageInfo(ctx, name, tag, m)
+	}
+
+	platforms := c.getPlatforms(ctx, name, m)
+	for _, p := range platforms {
+		if !p.Match(platform) {
+			continue
+		}
+
+		child, err := c.GetManifestContext(ctx, name, p.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("can not get image[%s:%s] manifest of platform %s, error: %w", name, tag, platform, err)
+		}
+
+		info, err := c.imageInfo(ctx, name, tag, child)
+		if err != nil {
+			return nil, err
+		}
+		info.Platform = p.String()
+		info.Platforms = platforms
+		return info, nil
+	}
+
+	return nil, fmt.Errorf("image[%s:%s] has no platform %s, error: %w", name, tag, platform, ERR_NOT_FOUND)
+}
@@ -4,6 +4,18 @@ import (
 	"encoding/json"
 	"errors"
 	"strconv"
+	"time"
+)
+
+const (
+	MediaTypeManifestV1       = "application/vnd.docker.distribution.manifest.v1+json"
+	MediaTypeSignedManifestV1 = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	MediaTypeManifestV2       = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest      = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex         = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageConfig      = "application/vnd.docker.container.image.v1+json"
+	MediaTypeOCIImageConfig   = "application/vnd.oci.image.config.v1+json"
 )
 
 type TagsResp struct {
@@ -77,8 +89,22 @@ type V1Config struct {
 	Volumes      map[string]interface{} `json:"Volumes"`
 	WorkingDir   string                 `json:"WorkingDir"`
 	Entrypoint   []string               `json:"Entrypoint"`
-	//OnBuild      []interface{}          `json:"OnBuild"`
-	//Labels       interface{}            `json:"Labels"`
+	OnBuild      []string               `json:"OnBuild"`
+	Labels       map[string]string      `json:"Labels"`
+	StopSignal   string                 `json:"StopSignal"`
+	StopTimeout  *int                   `json:"StopTimeout"`
+	Healthcheck  *HealthConfig          `json:"Healthcheck"`
+	Shell        []string               `json:"Shell"`
+	ArgsEscaped  bool                   `json:"ArgsEscaped"`
+}
+
+type HealthConfig struct {
+	Test          []string      `json:"Test"`
+	Interval      time.Duration `json:"Interval"`
+	Timeout       time.Duration `json:"Timeout"`
+	StartPeriod   time.Duration `json:"StartPeriod"`
+	StartInterval time.Duration `json:"StartInterval"`
+	Retries       int           `json:"Retries"`
 }
 
 type V1Signature struct {
@@ -106,6 +132,140 @@ type V2Layer struct {
 	Digest    string `json:"digest"`
 }
 
+// https://docs.docker.com/registry/spec/manifest-v2-2/#manifest-list
+type ManifestListResp struct {
+	Digest        string
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Manifests     []ManifestDescriptor `json:"manifests"`
+}
+
+type ManifestDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Size        uint64            `json:"size"`
+	Digest      string            `json:"digest"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+	Features     []string `json:"features,omitempty"`
+}
+
+// https://github.com/opencontainers/image-spec/blob/main/manifest.md
+type OCIManifestResp struct {
+	Digest        string
+	SchemaVersion int                 `json:"schemaVersion"`
+	MediaType     string              `json:"mediaType"`
+	ArtifactType  string              `json:"artifactType,omitempty"`
+	Config        V2Config            `json:"config"`
+	Layers        []V2Layer           `json:"layers"`
+	Subject       *ManifestDescriptor `json:"subject,omitempty"`
+	Annotations   map[string]string   `json:"annotations,omitempty"`
+}
+
+// https://github.com/opencontainers/image-spec/blob/main/image-index.md
+type OCIIndexResp struct {
+	Digest        string
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Manifests     []ManifestDescriptor `json:"manifests"`
+	Annotations   map[string]string    `json:"annotations,omitempty"`
+}
+
+// ManifestResp holds whichever manifest the registry served, exactly one of the pointers is set
+type ManifestResp struct {
+	MediaType string
+	Digest    string
+	V1        *ManifestV1Resp
+	V2        *ManifestV2Resp
+	List      *ManifestListResp
+	OCI       *OCIManifestResp
+	OCIIndex  *OCIIndexResp
+}
+
+// Manifests returns the children of a manifest list or oci index
+func (m *ManifestResp) Manifests() []ManifestDescriptor {
+	switch {
+	case m.List != nil:
+		return m.List.Manifests
+	case m.OCIIndex != nil:
+		return m.OCIIndex.Manifests
+	}
+	return nil
+}
+
+// Layers returns the layers of a schema2 or oci manifest, base layer first
+func (m *ManifestResp) Layers() []V2Layer {
+	switch {
+	case m.V2 != nil:
+		return m.V2.Layers
+	case m.OCI != nil:
+		return m.OCI.Layers
+	}
+	return nil
+}
+
+// Config returns the config descriptor of a schema2 or oci manifest
+func (m *ManifestResp) Config() V2Config {
+	switch {
+	case m.V2 != nil:
+		return m.V2.Config
+	case m.OCI != nil:
+		return m.OCI.Config
+	}
+	return V2Config{}
+}
+
+// Blobs returns the digests of the config and layers of a manifest, nil for a manifest list or oci index
+func (m *ManifestResp) Blobs() []string {
+	var blobs []string
+	switch {
+	case m.V1 != nil:
+		for _, layer := range m.V1.FSLayers {
+			blobs = append(blobs, layer.BlobSum)
+		}
+	case m.V2 != nil || m.OCI != nil:
+		blobs = append(blobs, m.Config().Digest)
+		for _, layer := range m.Layers() {
+			blobs = append(blobs, layer.Digest)
+		}
+	}
+	return blobs
+}
+
+// https://github.com/opencontainers/image-spec/blob/main/config.md
+type ImageConfig struct {
+	Created       string          `json:"created"`
+	Author        string          `json:"author"`
+	Architecture  string          `json:"architecture"`
+	OS            string          `json:"os"`
+	OSVersion     string          `json:"os.version"`
+	Variant       string          `json:"variant"`
+	DockerVersion string          `json:"docker_version"`
+	Config        V1Config        `json:"config"`
+	RootFS        RootFS          `json:"rootfs"`
+	History       []ConfigHistory `json:"history"`
+}
+
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ConfigHistory struct {
+	Created    string `json:"created"`
+	CreatedBy  string `json:"created_by"`
+	Author     string `json:"author"`
+	Comment    string `json:"comment"`
+	EmptyLayer bool   `json:"empty_layer"`
+}
+
 type CatalogResp struct {
 	Repositories []string `json:"repositories"`
 }
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy retries requests failing with 429, 502, 503, 504 or a network error.
+// GET and HEAD are retried on all of them, other methods only on 429 which the registry did not process
+type RetryPolicy struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	// longest wait before a retry, a registry asking to wait longer fails the request right away
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, MinBackoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second}
+
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *RegistryClient) error {
+		if policy.MaxRetries < 0 || policy.MinBackoff < 0 || policy.MaxBackoff < policy.MinBackoff {
+			return errors.New("invalid retry policy, need MaxRetries >= 0 and 0 <= MinBackoff <= MaxBackoff")
+		}
+		c.retry = policy
+		return nil
+	}
+}
+
+func retryable(method string, statusCode int, err error) bool {
+	if err == nil && statusCode == 429 {
+		return true
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+	if err != nil {
+		return !isContextError(err)
+	}
+	return statusCode == 502 || statusCode == 503 || statusCode == 504
+}
+
+// backoff is the wait before retrying after attempt (from 0), what the registry asked for if it did,
+// else exponential with jitter. false when the registry asks for more than MaxBackoff
+func (p RetryPolicy) backoff(attempt int, r *registryResp) (time.Duration, bool) {
+	if r != nil {
+		if wait, ok := retryAfter(r, time.Now()); ok {
+			return wait, wait <= p.MaxBackoff
+		}
+	}
+
+	max := p.MinBackoff << uint(attempt)
+	if max > p.MaxBackoff || max < p.MinBackoff {
+		max = p.MaxBackoff
+	}
+	return max/2 + time.Duration(rand.Int63n(int64(max/2)+1)), true
+}
+
+// retryAfter reads Retry-After, seconds or a date, then RateLimit-Reset when the quota is used up
+func retryAfter(r *registryResp, now time.Time) (time.Duration, bool) {
+	if r.RetryAfter != "" {
+		if seconds, err := strconv.Atoi(r.RetryAfter); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if t, err := http.ParseTime(r.RetryAfter); err == nil {
+			if t.Before(now) {
+				return 0, true
+			}
+			return t.Sub(now), true
+		}
+	}
+
+	if limit, ok := parseRateLimit(r, now); ok && limit.Remaining == 0 && !limit.Reset.IsZero() {
+		return limit.Reset.Sub(now), true
+	}
+
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RateLimit is the quota announced by the RateLimit-* headers of the last response carrying them,
+// eg, "RateLimit-Remaining: 76;w=21600" of Docker Hub
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	// zero when the registry does not say
+	Window  time.Duration
+	Reset   time.Time
+	Updated time.Time
+}
+
+func parseRateLimit(r *registryResp, now time.Time) (RateLimit, bool) {
+	if r.RateLimitLimit == "" && r.RateLimitRemaining == "" {
+		return RateLimit{}, false
+	}
+
+	limit := RateLimit{Remaining: -1, Updated: now}
+	var window int
+	limit.Limit, window = parseQuota(r.RateLimitLimit)
+	limit.Remaining, _ = parseQuota(r.RateLimitRemaining)
+	limit.Window = time.Duration(window) * time.Second
+	if reset, err := strconv.Atoi(r.RateLimitReset); err == nil && reset >= 0 {
+		limit.Reset = now.Add(time.Duration(reset) * time.Second)
+	}
+
+	return limit, limit.Remaining >= 0
+}
+
+// parseQuota reads "100;w=21600" into 100 and 21600, -1 when there is no number
+func parseQuota(value string) (int, int) {
+	parts := strings.Split(value, ";")
+	n, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		n = -1
+	}
+
+	window := 0
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && kv[0] == "w" {
+			window, _ = strconv.Atoi(kv[1])
+		}
+	}
+	return n, window
+}
+
+func (c *RegistryClient) updateRateLimit(r *registryResp) {
+	if limit, ok := parseRateLimit(r, time.Now()); ok {
+		c.rateMutex.Lock()
+		c.rateLimit = limit
+		c.rateMutex.Unlock()
+	}
+}
+
+// RateLimit is the quota left as the registry last told us, false when it never did
+func (c *RegistryClient) RateLimit() (RateLimit, bool) {
+	c.rateMutex.Lock()
+	defer c.rateMutex.Unlock()
+	return c.rateLimit, !c.rateLimit.Updated.IsZero()
+}
+
+// WithRateLimit sends at most perSecond requests to the registry, after bursts of up to burst requests
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *RegistryClient) error {
+		if perSecond <= 0 || burst < 1 {
+			return errors.New("invalid rate limit, need a positive rate and burst")
+		}
+		c.limiter = &rateLimiter{perSecond: perSecond, burst: float64(burst), tokens: float64(burst)}
+		return nil
+	}
+}
+
+// rateLimiter is a token bucket, waiters reserve their token up front so they are served in order
+type rateLimiter struct {
+	mutex     sync.Mutex
+	perSecond float64
+	burst     float64
+	tokens    float64
+	last      time.Time
+}
+
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.perSecond
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.perSecond * float64(time.Second))
+	l.mutex.Unlock()
+
+	if err := sleepContext(ctx, wait); err != nil {
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return err
+	}
+	return nil
+}
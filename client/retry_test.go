@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		resp   registryResp
+		want   time.Duration
+		wantOK bool
+	}{
+		{registryResp{}, 0, false},
+		{registryResp{RetryAfter: "0"}, 0, true},
+		{registryResp{RetryAfter: "120"}, 2 * time.Minute, true},
+		{registryResp{RetryAfter: "Wed, 01 May 2024 12:00:30 GMT"}, 30 * time.Second, true},
+		{registryResp{RetryAfter: "Wednesday, 01-May-24 12:01:00 GMT"}, time.Minute, true},
+		{registryResp{RetryAfter: "Wed, 01 May 2024 11:59:00 GMT"}, 0, true},
+		{registryResp{RetryAfter: "-5"}, 0, false},
+		{registryResp{RetryAfter: "soon"}, 0, false},
+		// the quota is used up, wait for its reset
+		{registryResp{RateLimitLimit: "100;w=21600", RateLimitRemaining: "0;w=21600", RateLimitReset: "90"}, 90 * time.Second, true},
+		{registryResp{RateLimitLimit: "100", RateLimitRemaining: "3", RateLimitReset: "90"}, 0, false},
+		{registryResp{RetryAfter: "5", RateLimitRemaining: "0", RateLimitReset: "90"}, 5 * time.Second, true},
+	}
+
+	for _, test := range tests {
+		got, ok := retryAfter(&test.resp, now)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("retryAfter(%+v) = %s, %v, want %s, %v", test.resp, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		value      string
+		want       int
+		wantWindow int
+	}{
+		{"", -1, 0},
+		{"100", 100, 0},
+		{"76;w=21600", 76, 21600},
+		{" 76 ; w=21600 ; burst=5", 76, 21600},
+		{"many", -1, 0},
+	}
+
+	for _, test := range tests {
+		n, window := parseQuota(test.value)
+		if n != test.want || window != test.wantWindow {
+			t.Errorf("parseQuota(%q) = %d, %d, want %d, %d", test.value, n, window, test.want, test.wantWindow)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		method     string
+		statusCode int
+		err        error
+		want       bool
+	}{
+		{http.MethodGet, 429, nil, true},
+		{http.MethodPut, 429, nil, true},
+		{http.MethodGet, 503, nil, true},
+		{http.MethodHead, 502, nil, true},
+		{http.MethodPut, 503, nil, false},
+		{http.MethodGet, 500, nil, false},
+		{http.MethodGet, 404, nil, false},
+		{http.MethodGet, 0, context.Canceled, false},
+		{http.MethodGet, 0, errTest("connection reset"), true},
+		{http.MethodPost, 0, errTest("connection reset"), false},
+	}
+
+	for _, test := range tests {
+		if got := retryable(test.method, test.statusCode, test.err); got != test.want {
+			t.Errorf("retryable(%s, %d, %v) = %v, want %v", test.method, test.statusCode, test.err, got, test.want)
+		}
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string {
+	return string(e)
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for attempt := 0; attempt < 8; attempt++ {
+		max := policy.MinBackoff << uint(attempt)
+		if max > policy.MaxBackoff {
+			max = policy.MaxBackoff
+		}
+		wait, ok := policy.backoff(attempt, nil)
+		if !ok || wait < max/2 || wait > max {
+			t.Errorf("backoff(%d) = %s, %v, want between %s and %s", attempt, wait, ok, max/2, max)
+		}
+	}
+
+	if wait, ok := policy.backoff(0, &registryResp{RetryAfter: "1"}); !ok || wait != time.Second {
+		t.Errorf("backoff with Retry-After: 1 = %s, %v, want 1s, true", wait, ok)
+	}
+	if _, ok := policy.backoff(0, &registryResp{RetryAfter: "2"}); ok {
+		t.Errorf("backoff with Retry-After past MaxBackoff is ok, want to give up")
+	}
+}
+
+func TestRetryOn503(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("RateLimit-Limit", "100;w=60")
+		w.Header().Set("RateLimit-Remaining", "97;w=60")
+		w.Header().Set("Docker-Content-Digest", "sha256:ab12")
+	}))
+	defer srv.Close()
+
+	c, err := NewRegistryClient("http", strings.TrimPrefix(srv.URL, "http://"),
+		WithRetry(RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := c.GetDigestContext(context.Background(), "x", "v1")
+	if err != nil || digest != "sha256:ab12" {
+		t.Fatalf("GetDigest = %s, %v, want sha256:ab12 after retries", digest, err)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+
+	limit, ok := c.RateLimit()
+	if !ok || limit.Limit != 100 || limit.Remaining != 97 || limit.Window != time.Minute {
+		t.Errorf("RateLimit = %+v, %v, want 97 of 100 per minute", limit, ok)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type TLSOptions struct {
+	// PEM bundle of extra CAs, added to the system pool
+	CAFile string
+	// docker style directory, <CertsDir>/<host:port>/ holding *.crt CAs and *.cert/*.key client pairs
+	CertsDir string
+	// client certificate for mutual TLS
+	CertFile string
+	KeyFile  string
+	// skip server certificate verification, only for registries with self-signed certs you can not distribute
+	Insecure bool
+}
+
+func WithTLS(options TLSOptions) Option {
+	return func(c *RegistryClient) error {
+		c.tlsOptions = options
+		return nil
+	}
+}
+
+func (o TLSOptions) config(host string) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: o.Insecure}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	customRoots := false
+
+	if o.CAFile != "" {
+		if err := appendCAFile(roots, o.CAFile); err != nil {
+			return nil, err
+		}
+		customRoots = true
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, errors.New("can not load client cert[" + o.CertFile + "] key[" + o.KeyFile + "], error: " + err.Error())
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	if o.CertsDir != "" {
+		dir := filepath.Join(o.CertsDir, host)
+		files, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		for _, f := range files {
+			name := f.Name()
+			switch {
+			case strings.HasSuffix(name, ".crt"):
+				if err := appendCAFile(roots, filepath.Join(dir, name)); err != nil {
+					return nil, err
+				}
+				customRoots = true
+
+			case strings.HasSuffix(name, ".cert"):
+				keyName := strings.TrimSuffix(name, ".cert") + ".key"
+				cert, err := tls.LoadX509KeyPair(filepath.Join(dir, name), filepath.Join(dir, keyName))
+				if err != nil {
+					return nil, errors.New("can not load client cert[" + name + "] key[" + keyName + "] in " + dir + ", error: " + err.Error())
+				}
+				config.Certificates = append(config.Certificates, cert)
+
+			case strings.HasSuffix(name, ".key"):
+				certName := strings.TrimSuffix(name, ".key") + ".cert"
+				if _, err := os.Stat(filepath.Join(dir, certName)); err != nil {
+					return nil, errors.New("missing client certificate[" + certName + "] for key[" + name + "] in " + dir)
+				}
+			}
+		}
+	}
+
+	if customRoots {
+		config.RootCAs = roots
+	}
+
+	return config, nil
+}
+
+func appendCAFile(pool *x509.CertPool, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return errors.New("no certificate found in CA file[" + path + "]")
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ConnectionOptions tune how connections to the registry are pooled and reused
+type ConnectionOptions struct {
+	// connections to one host at a time, requests beyond wait for one to be free. 0 for no limit
+	MaxPerHost int
+	// idle connections kept per host for the next requests
+	MaxIdlePerHost int
+	IdleTimeout    time.Duration
+	// a new connection for every request, only to compare with or for proxies breaking reused connections
+	DisableKeepAlives bool
+}
+
+var DefaultConnectionOptions = ConnectionOptions{MaxPerHost: 32, MaxIdlePerHost: 32, IdleTimeout: 90 * time.Second}
+
+func WithConnections(options ConnectionOptions) Option {
+	return func(c *RegistryClient) error {
+		if options.MaxPerHost < 0 || options.MaxIdlePerHost < 0 || options.IdleTimeout < 0 {
+			return errors.New("invalid connection options, limits can not be negative")
+		}
+		c.connections = options
+		return nil
+	}
+}
+
+// newTransport is shared by every request of the client, so connections are reused as long as
+// each response body is read to the end and closed, see sendOnce
+func (c *RegistryClient) newTransport(protocol string, host string) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: c.timeouts.Dial, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   c.timeouts.TLSHandshake,
+		ResponseHeaderTimeout: c.timeouts.ResponseHeader,
+		ExpectContinueTimeout: time.Second,
+		// a custom dialer or tls config turns HTTP/2 off unless asked for
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        c.connections.MaxIdlePerHost * 2,
+		MaxIdleConnsPerHost: c.connections.MaxIdlePerHost,
+		MaxConnsPerHost:     c.connections.MaxPerHost,
+		IdleConnTimeout:     c.connections.IdleTimeout,
+		DisableKeepAlives:   c.connections.DisableKeepAlives,
+	}
+
+	if protocol == "https" {
+		tlsConfig, err := c.tlsOptions.config(host)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+// checkRedirect keeps our credentials from the hosts a registry redirects to, eg, presigned storage urls.
+// The http client only drops them for hosts outside the domain of the registry
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	first := via[0].URL
+	if req.URL.Host != first.Host || (first.Scheme == "https" && req.URL.Scheme != "https") {
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// isRegistryURL tells if u is on the registry host, over https when the registry is
+func (c *RegistryClient) isRegistryURL(u *url.URL) bool {
+	base, err := url.Parse(c.host)
+	if err != nil {
+		return false
+	}
+	return u.Host == base.Host && (base.Scheme != "https" || u.Scheme == "https")
+}
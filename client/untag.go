@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// GetDigestContext resolves reference to its manifest digest with a HEAD request
+func (c *RegistryClient) GetDigestContext(ctx context.Context, name string, reference string) (string, error) {
+	headers := make(map[string]string)
+	headers["Accept"] = manifestAccept
+
+	r, err := c.doRequest(ctx, http.MethodHead, name+"/manifests/"+reference, headers)
+	if err != nil {
+		return "", err
+	}
+
+	if r.StatusCode == 404 {
+		return "", newRegistryError(r)
+	}
+
+	if r.StatusCode != 200 || r.Digest == "" {
+		// some registries answer HEAD without Docker-Content-Digest
+		m, err := c.GetManifestContext(ctx, name, reference)
+		if err != nil {
+			return "", err
+		}
+		return m.Digest, nil
+	}
+
+	return r.Digest, nil
+}
+
+// TagsWithDigestContext lists the tags of repository name pointing at digest.
+// A tag whose digest can not be told fails the whole list, it may be one deleted with digest
+func (c *RegistryClient) TagsWithDigestContext(ctx context.Context, name string, digest string) ([]string, error) {
+	tags, err := c.GetTagsContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// one HEAD per tag, at most c.parallelism at a time, the first failure cancels the rest
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	digests := make([]string, len(tags))
+	errs := make([]error, len(tags))
+	sem := make(chan struct{}, c.parallelism)
+	var wg sync.WaitGroup
+
+	for i, tag := range tags {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			d, err := c.GetDigestContext(ctx, name, tag)
+			if err != nil && !errors.Is(err, ERR_NOT_FOUND) {
+				errs[i] = fmt.Errorf("can not get digest of [%s:%s], error: %w", name, tag, err)
+				cancel()
+				return
+			}
+			// not found: deleted since we listed it
+			digests[i] = d
+		}(i, tag)
+	}
+	wg.Wait()
+
+	// the error which canceled the others, not the cancellations
+	for _, err := range errs {
+		if err != nil && !isContextError(err) {
+			return nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for i, tag := range tags {
+		if digests[i] == digest {
+			result = append(result, tag)
+		}
+	}
+
+	return result, nil
+}
+
+// TagsSharingDigestContext returns the digest of tag and the other tags that DeleteTag would remove with it
+func (c *RegistryClient) TagsSharingDigestContext(ctx context.Context, name string, tag string) (string, []string, error) {
+	digest, err := c.GetDigestContext(ctx, name, tag)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tags, err := c.TagsWithDigestContext(ctx, name, digest)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var shared []string
+	for _, t := range tags {
+		if t != tag {
+			shared = append(shared, t)
+		}
+	}
+
+	return digest, shared, nil
+}
+
+// UntagTagContext removes only tag, leaving other tags of the same manifest alone.
+// Registries following the OCI distribution spec delete a tag reference directly,
+// others (e.g. distribution 2.x) get the tag re-pointed to a throwaway manifest which is then deleted.
+// Nothing is pushed when the registry does not allow deleting manifests at all
+func (c *RegistryClient) UntagTagContext(ctx context.Context, name string, tag string) error {
+	r, err := c.doRequest(ctx, http.MethodDelete, name+"/manifests/"+tag, nil)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode == 202 {
+		return nil
+	}
+
+	// distribution answers UNSUPPORTED with 400, others 405, fall back to the placeholder then
+	e := newRegistryError(r)
+	if !e.Is(ERR_UNSUPPORTED) && !(r.StatusCode == 400 && len(e.Errors) == 0) {
+		return e
+	}
+
+	if err := c.checkDeleteAllowed(ctx, name); err != nil {
+		return fmt.Errorf("registry can not delete [%s:%s], error: %w", name, tag, err)
+	}
+
+	original, err := c.GetRawManifestContext(ctx, name, tag)
+	if err != nil {
+		return err
+	}
+
+	placeholder, err := c.pushPlaceholder(ctx, name, tag)
+	if err != nil {
+		return fmt.Errorf("registry can not delete tags and re-pointing [%s:%s] fail, error: %w", name, tag, err)
+	}
+
+	if err := c.deleteByDigest(ctx, name, placeholder); err != nil {
+		// put the tag back where it was
+		if _, restoreErr := c.PutManifestContext(ctx, name, tag, original.MediaType, original.Body); restoreErr != nil {
+			return fmt.Errorf("can not delete placeholder of [%s:%s] (%v), and restoring the tag to %s fail, error: %w",
+				name, tag, err, original.Digest, restoreErr)
+		}
+		return fmt.Errorf("can not delete placeholder of [%s:%s], the tag is restored, error: %w", name, tag, err)
+	}
+
+	return nil
+}
+
+// checkDeleteAllowed deletes a manifest that can not exist, registries allowing deletes answer 404,
+// those with deletes disabled (distribution's default) refuse before looking it up
+func (c *RegistryClient) checkDeleteAllowed(ctx context.Context, name string) error {
+	probe := digestOf([]byte("docker-registry-viewer delete probe " + time.Now().String()))
+
+	err := c.deleteByDigest(ctx, name, probe)
+	if err == nil || errors.Is(err, ERR_NOT_FOUND) {
+		return nil
+	}
+	return err
+}
+
+// pushPlaceholder tags an empty image unique to this call as name:tag, so deleting it touches nothing else
+func (c *RegistryClient) pushPlaceholder(ctx context.Context, name string, tag string) (string, error) {
+	config, err := json.Marshal(ImageConfig{
+		Created:      time.Now().UTC().Format(time.RFC3339Nano),
+		Architecture: "none",
+		OS:           "none",
+		Config: V1Config{Labels: map[string]string{
+			"docker-registry-viewer.placeholder": name + ":" + tag,
+		}},
+		RootFS: RootFS{Type: "layers", DiffIDs: []string{}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	configDigest, err := c.PushBlobContext(ctx, name, config)
+	if err != nil {
+		return "", err
+	}
+
+	manifest, err := json.Marshal(struct {
+		SchemaVersion int       `json:"schemaVersion"`
+		MediaType     string    `json:"mediaType"`
+		Config        V2Config  `json:"config"`
+		Layers        []V2Layer `json:"layers"`
+	}{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifestV2,
+		Config:        V2Config{MediaType: MediaTypeImageConfig, Size: uint64(len(config)), Digest: configDigest},
+		Layers:        []V2Layer{},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return c.PutManifestContext(ctx, name, tag, MediaTypeManifestV2, manifest)
+}
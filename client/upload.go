@@ -0,0 +1,246 @@
+// Reference: https://docs.docker.com/registry/spec/api/#pushing-an-image
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// uploadLocation turns the Location of an upload session answering the request to from into a url for doRequest,
+// with extra query params
+func (c *RegistryClient) uploadLocation(from string, location string, params map[string]string) (string, error) {
+	u, err := c.resolveLocation(from, location, params)
+	if err != nil {
+		return "", errors.New("invalid upload location[" + location + "], error: " + err.Error())
+	}
+	return u, nil
+}
+
+// DefaultChunkSize is the size of each PATCH of PushBlobChunked when none is given
+const DefaultChunkSize = 16 << 20
+
+// BlobExistsContext HEADs blob digest in repository name, size is -1 when the registry does not say
+func (c *RegistryClient) BlobExistsContext(ctx context.Context, name string, digest string) (bool, int64, error) {
+	r, err := c.doRequest(ctx, http.MethodHead, name+"/blobs/"+digest, nil)
+	if err != nil {
+		return false, 0, err
+	}
+
+	switch r.StatusCode {
+	case 200:
+		return true, r.ContentLength, nil
+	case 404:
+		return false, 0, nil
+	}
+	return false, 0, newRegistryError(r)
+}
+
+// PushBlobContext uploads data in one piece unless the repository has it already, and returns its digest
+func (c *RegistryClient) PushBlobContext(ctx context.Context, name string, data []byte) (string, error) {
+	digest := digestOf(data)
+
+	if exists, _, err := c.BlobExistsContext(ctx, name, digest); err != nil {
+		return "", err
+	} else if exists {
+		return digest, nil
+	}
+
+	path, err := c.startUpload(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	return digest, c.finishUpload(ctx, name, path, digest, data)
+}
+
+// PushBlobChunkedContext uploads what r reads in chunks of chunkSize, DefaultChunkSize if chunkSize <= 0.
+// With digest given, a blob the repository has already is skipped and r must match it. It returns the digest
+func (c *RegistryClient) PushBlobChunkedContext(ctx context.Context, name string, digest string, r io.Reader, chunkSize int) (string, error) {
+	if digest != "" {
+		if exists, _, err := c.BlobExistsContext(ctx, name, digest); err != nil {
+			return "", err
+		} else if exists {
+			return digest, nil
+		}
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	path, err := c.startUpload(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	chunk := make([]byte, chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			h.Write(chunk[:n])
+			if path, err = c.uploadChunk(ctx, name, path, offset, chunk[:n]); err != nil {
+				c.cancelUpload(ctx, path)
+				return "", err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			c.cancelUpload(ctx, path)
+			return "", err
+		}
+	}
+
+	got := fmt.Sprintf("sha256:%x", h.Sum(nil))
+	if digest != "" && got != digest {
+		c.cancelUpload(ctx, path)
+		return "", fmt.Errorf("blob pushed to [%s] is %s instead of %s: %w", name, got, digest, ERR_DIGEST_MISMATCH)
+	}
+
+	return got, c.finishUpload(ctx, name, path, got, nil)
+}
+
+// MountBlobContext links blob digest of repository from into repository name without uploading it.
+// false when the registry can not, eg, from is unknown to it or it does not support mounts
+func (c *RegistryClient) MountBlobContext(ctx context.Context, name string, from string, digest string) (bool, error) {
+	query := url.Values{}
+	query.Set("mount", digest)
+	query.Set("from", from)
+
+	path := name + "/blobs/uploads/?" + query.Encode()
+	r, err := c.doRequest(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return false, err
+	}
+
+	switch r.StatusCode {
+	case 201:
+		return true, nil
+	case 202:
+		// an upload session was opened instead, we do not need it
+		if location, err := c.uploadLocation(path, r.Location, nil); err == nil {
+			c.cancelUpload(ctx, location)
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("can not mount blob[%s] from [%s] to [%s], error: %w", digest, from, name, newRegistryError(r))
+}
+
+// startUpload opens an upload session and returns the url to send it to
+func (c *RegistryClient) startUpload(ctx context.Context, name string) (string, error) {
+	path := name + "/blobs/uploads/"
+	r, err := c.doRequest(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if r.StatusCode != 202 {
+		return "", fmt.Errorf("can not start upload to [%s], error: %w", name, newRegistryError(r))
+	}
+
+	return c.uploadLocation(path, r.Location, nil)
+}
+
+// uploadChunk PATCHes data at offset and returns where the session goes on
+func (c *RegistryClient) uploadChunk(ctx context.Context, name string, path string, offset int64, data []byte) (string, error) {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/octet-stream"
+	headers["Content-Range"] = fmt.Sprintf("%d-%d", offset, offset+int64(len(data))-1)
+
+	r, err := c.doRequestWithBody(ctx, http.MethodPatch, path, headers, data)
+	if err != nil {
+		return path, err
+	}
+
+	if r.StatusCode != 202 {
+		return path, fmt.Errorf("can not upload chunk to [%s], error: %w", name, newRegistryError(r))
+	}
+
+	return c.uploadLocation(path, r.Location, nil)
+}
+
+// finishUpload PUTs the last data, maybe none, and closes the session under digest
+func (c *RegistryClient) finishUpload(ctx context.Context, name string, path string, digest string, data []byte) error {
+	path, err := c.uploadLocation(path, path, map[string]string{"digest": digest})
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/octet-stream"
+	r, err := c.doRequestWithBody(ctx, http.MethodPut, path, headers, data)
+	if err != nil {
+		return err
+	}
+
+	if r.StatusCode != 201 {
+		return fmt.Errorf("can not upload blob[%s] to [%s], error: %w", digest, name, newRegistryError(r))
+	}
+
+	return nil
+}
+
+// cancelUpload drops an unfinished session, failing to is harmless, registries expire them
+func (c *RegistryClient) cancelUpload(ctx context.Context, path string) {
+	c.doRequest(ctx, http.MethodDelete, path, nil)
+}
+
+// PutManifestContext stores body under reference (tag or digest) and returns its digest.
+// mediaType is the Content-Type, taken from the manifest itself when empty
+func (c *RegistryClient) PutManifestContext(ctx context.Context, name string, reference string, mediaType string, body []byte) (string, error) {
+	if mediaType == "" {
+		var err error
+		if mediaType, err = manifestMediaType(body); err != nil {
+			return "", err
+		}
+	}
+
+	headers := make(map[string]string)
+	headers["Content-Type"] = mediaType
+
+	r, err := c.doRequestWithBody(ctx, http.MethodPut, name+"/manifests/"+reference, headers, body)
+	if err != nil {
+		return "", err
+	}
+
+	if r.StatusCode != 201 {
+		return "", newRegistryError(r)
+	}
+
+	if r.Digest != "" {
+		return r.Digest, nil
+	}
+	return digestOf(body), nil
+}
+
+// manifestMediaType reads the mediaType field, schema1 manifests have none
+func manifestMediaType(body []byte) (string, error) {
+	var versioned struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		MediaType     string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(body, &versioned); err != nil {
+		return "", errors.New("can not Unmarshal string\n\n" + string(body) + "\n\nerror: " + err.Error())
+	}
+
+	switch {
+	case versioned.MediaType != "":
+		return versioned.MediaType, nil
+	case versioned.SchemaVersion == 1:
+		return MediaTypeSignedManifestV1, nil
+	}
+	return "", errors.New("manifest without mediaType, give it explicitly")
+}
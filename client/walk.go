@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// how many entries are asked per page, registries may answer less
+const pageSize = 100
+
+var (
+	// return from a walk callback to stop early, the walk then returns nil
+	ERR_STOP_WALK = errors.New("stop walk")
+)
+
+// walkPages GETs path and the rel="next" links after it, fn decodes each page from its stream
+func (c *RegistryClient) walkPages(ctx context.Context, path string, fn func(r *registryResp) error) error {
+	seen := make(map[string]bool)
+	for path != "" && !seen[path] {
+		seen[path] = true
+
+		r, err := c.doStream(ctx, http.MethodGet, path, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		if r.StatusCode != 200 {
+			return newRegistryError(r)
+		}
+
+		err = fn(r)
+		closeBody(r)
+		if err != nil {
+			if err == ERR_STOP_WALK {
+				return nil
+			}
+			return err
+		}
+
+		next := nextLink(r.Link)
+		if next == "" {
+			break
+		}
+		if path, err = c.resolveLocation(path, next, nil); err != nil {
+			return errors.New("invalid next page link[" + next + "], error: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// WalkTagsContext calls fn with each page of the tags of repository name, fn may return ERR_STOP_WALK
+func (c *RegistryClient) WalkTagsContext(ctx context.Context, name string, fn func(tags []string) error) error {
+	return c.walkPages(ctx, name+"/tags/list?n="+strconv.Itoa(pageSize), func(r *registryResp) error {
+		var tags TagsResp
+		if err := c.decodeBody(r, &tags); err != nil {
+			return fmt.Errorf("can not decode tags of [%s], error: %w", name, err)
+		}
+		return fn(tags.Tags)
+	})
+}
+
+// WalkCatalogContext calls fn with each page of the repositories, fn may return ERR_STOP_WALK
+func (c *RegistryClient) WalkCatalogContext(ctx context.Context, fn func(repos []string) error) error {
+	return c.walkPages(ctx, "_catalog?n="+strconv.Itoa(pageSize), func(r *registryResp) error {
+		var catalog CatalogResp
+		if err := c.decodeBody(r, &catalog); err != nil {
+			return fmt.Errorf("can not decode catalog, error: %w", err)
+		}
+		return fn(catalog.Repositories)
+	})
+}
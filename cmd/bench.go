@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+// bench gets the info of every tag of a repo like the tags page does, with pooled connections
+// and then with a new connection per request. Each round uses a new client so nothing is cached
+func bench(ctx context.Context, protocol string, host string, options []client.Option) error {
+	if g_config.name == "" {
+		return errors.New("empty image name")
+	}
+	if g_config.rounds < 1 || g_config.parallel < 1 {
+		return errors.New("rounds and parallel must be positive")
+	}
+
+	modes := []struct {
+		name        string
+		connections client.ConnectionOptions
+	}{
+		{"keep-alive", client.DefaultConnectionOptions},
+		{"no keep-alive", client.ConnectionOptions{DisableKeepAlives: true}},
+	}
+
+	for _, mode := range modes {
+		var total time.Duration
+		var tags, failed int
+		for round := 0; round < g_config.rounds; round++ {
+			c, err := client.NewRegistryClient(protocol, host, append(options,
+				client.WithConnections(mode.connections), client.WithCache(client.NewMemoryCache(0)))...)
+			if err != nil {
+				return err
+			}
+
+			start := time.Now()
+			n, errs, err := benchRound(ctx, c)
+			if err != nil {
+				return err
+			}
+			total += time.Since(start)
+			tags += n
+			failed += errs
+		}
+
+		fmt.Printf("%-14s %d rounds of %d tags in %s, %.1f tags/s", mode.name, g_config.rounds, tags/g_config.rounds,
+			total.Round(time.Millisecond), float64(tags)/total.Seconds())
+		if failed > 0 {
+			fmt.Printf(", %d failed", failed)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func benchRound(ctx context.Context, c *client.RegistryClient) (int, int, error) {
+	tags, err := c.GetTagsContext(ctx, g_config.name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var failed int32
+	sem := make(chan struct{}, g_config.parallel)
+	var wg sync.WaitGroup
+	for _, tag := range tags {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(tag string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, err := c.GetImageInfoContext(ctx, g_config.name, tag); err != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+		}(tag)
+	}
+	wg.Wait()
+
+	return len(tags), int(failed), ctx.Err()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+// getBlob downloads to g_config.out, what an interrupted run left there is kept and only the rest is fetched
+func getBlob(ctx context.Context, c *client.RegistryClient) error {
+	if g_config.out == "-" {
+		_, err := c.DownloadBlobContext(ctx, g_config.name, g_config.digest, -1, os.Stdout)
+		return err
+	}
+
+	f, err := os.OpenFile(g_config.out, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > 0 {
+		fmt.Fprintln(os.Stderr, "resume from byte", info.Size())
+	}
+
+	// partial reads the file to its end, the rest is appended from there
+	size, err := c.ResumeBlobContext(ctx, g_config.name, g_config.digest, -1, f, f)
+	if err != nil {
+		if errors.Is(err, client.ERR_DIGEST_MISMATCH) {
+			fmt.Fprintln(os.Stderr, "hint: remove", g_config.out, "to download it again from the start")
+		}
+		return err
+	}
+
+	fmt.Println(g_config.out, client.HumanSize(uint64(size)))
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+// copyManifest pushes from:reference as to:toReference, with the manifests and blobs it references.
+// Blobs are mounted from the source repository when the registry can, streamed through us otherwise
+func copyManifest(ctx context.Context, c *client.RegistryClient, from string, reference string, to string, toReference string) (string, error) {
+	raw, err := c.GetRawManifestContext(ctx, from, reference)
+	if err != nil {
+		return "", err
+	}
+
+	if from != to {
+		m, err := raw.Decode()
+		if err != nil {
+			return "", err
+		}
+
+		for _, child := range m.Manifests() {
+			if _, err := copyManifest(ctx, c, from, child.Digest, to, child.Digest); err != nil {
+				return "", err
+			}
+		}
+		for _, digest := range m.Blobs() {
+			if err := copyBlob(ctx, c, from, to, digest); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return c.PutManifestContext(ctx, to, toReference, raw.MediaType, raw.Body)
+}
+
+func copyBlob(ctx context.Context, c *client.RegistryClient, from string, to string, digest string) error {
+	mounted, err := c.MountBlobContext(ctx, to, from, digest)
+	if err != nil || mounted {
+		return err
+	}
+
+	blob, size, err := c.GetBlobContext(ctx, from, digest)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	// PushBlobChunked checks the digest of what it read
+	if _, err := c.PushBlobChunkedContext(ctx, to, digest, blob, 0); err != nil {
+		return err
+	}
+	fmt.Println("uploaded", digest, client.HumanSize(uint64(size)))
+	return nil
+}
@@ -1,20 +1,53 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/mkdym/docker-registry-viewer/client"
+	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	fn   string
-	host string
-	name string
-	tag  string
-	sort bool
+	fn           string
+	host         string
+	username     string
+	password     string
+	dockerConfig string
+	tls          client.TLSOptions
+	name         string
+	tag          string
+	platform     string
+	labels       labelsFlag
+	sort         bool
+	untag        bool
+	force        bool
+	cacheDir     string
+	timeout      time.Duration
+	retries      int
+	rateLimit    float64
+	rounds       int
+	parallel     int
+	digest       string
+	out          string
+	toName       string
+	toTag        string
+}
+
+// labelsFlag collects every -label given, values may have spaces
+type labelsFlag []string
+
+func (l *labelsFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *labelsFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func (c Config) String() string {
@@ -28,22 +61,78 @@ var (
 func main() {
 	HandleFlag()
 	if err := Exec(); err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, "error:", err.Error())
+		printRegistryError(err)
+		os.Exit(1)
+	}
+}
+
+// printRegistryError adds the details of a registry error and a hint for common codes
+func printRegistryError(err error) {
+	var regErr *client.RegistryError
+	if !errors.As(err, &regErr) {
+		return
+	}
+
+	for _, d := range regErr.Errors {
+		if len(d.Detail) > 0 {
+			fmt.Fprintln(os.Stderr, "detail:", string(d.Detail))
+		}
+	}
+
+	switch {
+	case errors.Is(err, client.ERR_UNAUTHORIZED):
+		fmt.Fprintln(os.Stderr, "hint: check -username/-password or the credentials in -docker-config")
+	case errors.Is(err, client.ERR_DENIED):
+		fmt.Fprintln(os.Stderr, "hint: the credentials are valid but lack permission")
+	case errors.Is(err, client.ERR_UNSUPPORTED):
+		fmt.Fprintln(os.Stderr, "hint: the registry does not allow this, eg, deletes need REGISTRY_STORAGE_DELETE_ENABLED=true")
+	case errors.Is(err, client.ERR_TOOMANYREQUESTS):
+		if regErr.RetryAfter > 0 {
+			fmt.Fprintln(os.Stderr, "hint: rate limited by the registry, try again in", regErr.RetryAfter)
+		} else {
+			fmt.Fprintln(os.Stderr, "hint: rate limited by the registry, try again later")
+		}
 	}
 }
 
 func HandleFlag() {
 	flag.StringVar(&g_config.fn, "fn", "", `specify a function, can be one of followings:
-		get_digest/get_digest2: get an image's digest. need name and tag
-		list_tags: list a repo's tags. need name
+		get_digest/get_digest2: get an image's schema1/current manifest digest. need name and tag
+		list_tags: list a repo's tags. need name, optional label
 		list_repos: list all repos
 		list_all: list all repo and its tags
-		delete: delete image tag. need name and tag
-		get_info: get image info, need name and tag`)
+		delete: delete image tag, refused when other tags share its digest unless force. need name and tag, optional untag or force
+		get_info: get image info, need name and tag, optional platform
+		get_blob: download a blob and check its digest, resuming an unfinished out file. need name, digest and out
+		copy: push an image as another tag or repo of the same registry. need name, tag and to-name or to-tag
+		bench: time getting every tag's info with and without connection reuse. need name, optional rounds and parallel`)
 	flag.StringVar(&g_config.host, "host", "", "specify registry host, eg, https://example.com:5000, 127.0.0.1:5000. if ssl on, must add 'https://'")
+	flag.StringVar(&g_config.username, "username", "", "specify registry username, used for basic auth or the token server")
+	flag.StringVar(&g_config.password, "password", "", "specify registry password")
+	flag.StringVar(&g_config.dockerConfig, "docker-config", client.DefaultDockerConfigPath(), "docker config.json to read credentials from when no username given, empty to disable")
+	flag.StringVar(&g_config.tls.CAFile, "ca-file", "", "specify a PEM CA bundle to verify the registry with")
+	flag.StringVar(&g_config.tls.CertsDir, "certs-dir", "", "specify a docker style certs.d directory, <dir>/<host:port>/ holds ca.crt, client.cert, client.key")
+	flag.StringVar(&g_config.tls.CertFile, "cert", "", "specify client certificate for mutual TLS")
+	flag.StringVar(&g_config.tls.KeyFile, "key", "", "specify client key for mutual TLS")
+	flag.BoolVar(&g_config.tls.Insecure, "insecure", false, "skip registry certificate verification")
 	flag.StringVar(&g_config.name, "name", "", "specify image name")
 	flag.StringVar(&g_config.tag, "tag", "", "sepcify image tag")
+	flag.StringVar(&g_config.platform, "platform", "", "specify platform of a multi-arch image for get_info, eg, linux/arm64")
+	flag.Var(&g_config.labels, "label", "filter list_tags by an image label, key=value or key, eg, 'org.opencontainers.image.version=1.0'. repeat for more")
 	flag.BoolVar(&g_config.sort, "sort", false, "sort output")
+	flag.StringVar(&g_config.cacheDir, "cache-dir", "", "specify a directory to cache manifests, config blobs and blob sizes in")
+	flag.DurationVar(&g_config.timeout, "timeout", 0, "give up after this long, eg, 30s, 0 for no limit")
+	flag.IntVar(&g_config.retries, "retries", client.DefaultRetryPolicy.MaxRetries, "retry requests failing with 429, 502, 503, 504 this many times")
+	flag.Float64Var(&g_config.rateLimit, "rate-limit", 0, "send at most this many requests per second, 0 for no limit")
+	flag.StringVar(&g_config.digest, "digest", "", "specify blob digest for get_blob, eg, sha256:...")
+	flag.StringVar(&g_config.out, "out", "", "specify file get_blob writes to, - for stdout")
+	flag.StringVar(&g_config.toName, "to-name", "", "specify target image name for copy, default name")
+	flag.StringVar(&g_config.toTag, "to-tag", "", "specify target image tag for copy, default tag")
+	flag.IntVar(&g_config.rounds, "rounds", 3, "rounds of bench for each connection mode")
+	flag.IntVar(&g_config.parallel, "parallel", 8, "tags fetched at a time by bench and delete")
+	flag.BoolVar(&g_config.untag, "untag", false, "delete only the given tag, keep other tags of the same digest")
+	flag.BoolVar(&g_config.force, "force", false, "delete even if other tags share the digest, they are deleted too")
 
 	flag.Parse()
 	if g_config.host == "" {
@@ -62,11 +151,44 @@ func Exec() error {
 		host = strings.TrimPrefix(host, "https://")
 	}
 
-	c, err := client.NewRegistryClient(protocol, host)
+	username, password := g_config.username, g_config.password
+	if username == "" && g_config.dockerConfig != "" {
+		var err error
+		if username, password, err = client.LoadDockerCredentials(g_config.dockerConfig, host); err != nil {
+			return err
+		}
+	}
+
+	retry := client.DefaultRetryPolicy
+	retry.MaxRetries = g_config.retries
+	options := []client.Option{client.WithTLS(g_config.tls), client.WithRetry(retry), client.WithParallelism(g_config.parallel)}
+	if g_config.rateLimit > 0 {
+		options = append(options, client.WithRateLimit(g_config.rateLimit, 1))
+	}
+	if username != "" {
+		options = append(options, client.WithCredentials(username, password))
+	}
+	if g_config.cacheDir != "" {
+		cache, err := client.NewDiskCache(g_config.cacheDir)
+		if err != nil {
+			return err
+		}
+		options = append(options, client.WithCache(cache))
+	}
+
+	c, err := client.NewRegistryClient(protocol, host, options...)
 	if err != nil {
 		return err
 	}
-	if err := c.Ping(); err != nil {
+
+	ctx := context.Background()
+	if g_config.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g_config.timeout)
+		defer cancel()
+	}
+
+	if err := c.PingContext(ctx); err != nil {
 		return err
 	}
 
@@ -76,8 +198,8 @@ func Exec() error {
 			return errors.New("empty image name or tag")
 		}
 
-		resp, err := c.GetManifestV1(g_config.name, g_config.tag)
-		if err != nil && err != client.ERR_IMAGE_NOT_FOUND {
+		resp, err := c.GetManifestV1Context(ctx, g_config.name, g_config.tag)
+		if err != nil && !errors.Is(err, client.ERR_NOT_FOUND) {
 			return err
 		}
 
@@ -90,8 +212,8 @@ func Exec() error {
 			return errors.New("empty image name or tag")
 		}
 
-		resp, err := c.GetManifestV2(g_config.name, g_config.tag)
-		if err != nil && err != client.ERR_IMAGE_NOT_FOUND {
+		resp, err := c.GetManifestContext(ctx, g_config.name, g_config.tag)
+		if err != nil && !errors.Is(err, client.ERR_NOT_FOUND) {
 			return err
 		}
 
@@ -104,27 +226,37 @@ func Exec() error {
 			return errors.New("empty image name")
 		}
 
-		tags, err := c.GetTags(g_config.name)
+		// print page by page, repos may have many thousand tags
+		labels := []string(g_config.labels)
+		err := c.WalkTagsContext(ctx, g_config.name, func(tags []string) error {
+			for _, s := range tags {
+				if len(labels) > 0 {
+					info, err := c.GetImageInfoContext(ctx, g_config.name, s)
+					if err != nil || !info.MatchLabels(labels) {
+						continue
+					}
+				}
+				fmt.Println(s)
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
 
-		for _, s := range tags {
-			fmt.Println(s)
-		}
-
 	case "list_repos":
-		repos, err := c.GetCatalog()
+		err := c.WalkCatalogContext(ctx, func(repos []string) error {
+			for _, s := range repos {
+				fmt.Println(s)
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
 
-		for _, s := range repos {
-			fmt.Println(s)
-		}
-
 	case "list_all":
-		repos, err := c.GetCatalog()
+		repos, err := c.GetCatalogContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -132,7 +264,7 @@ func Exec() error {
 		for _, name := range repos {
 			fmt.Printf("%-20s\t", name)
 
-			if tags, err := c.GetTags(name); err == nil {
+			if tags, err := c.GetTagsContext(ctx, name); err == nil {
 				fmt.Printf("%-2d\t\t", len(tags))
 
 				if g_config.sort {
@@ -156,7 +288,29 @@ func Exec() error {
 			return errors.New("empty image name or tag")
 		}
 
-		if err := c.DeleteTag(g_config.name, g_config.tag); err != nil {
+		if g_config.untag {
+			if err := c.UntagTagContext(ctx, g_config.name, g_config.tag); err != nil {
+				return err
+			}
+
+			fmt.Println("success")
+			break
+		}
+
+		digest, shared, err := c.TagsSharingDigestContext(ctx, g_config.name, g_config.tag)
+		if err != nil {
+			return err
+		}
+
+		if len(shared) > 0 {
+			if !g_config.force {
+				return errors.New("tags pointing at " + digest + " would be deleted too: " + strings.Join(shared, ", ") +
+					", use -untag to delete only " + g_config.tag + " or -force to delete them all")
+			}
+			fmt.Println("tags pointing at", digest, "deleted too:", strings.Join(shared, ", "))
+		}
+
+		if err := c.DeleteManifestContext(ctx, g_config.name, digest); err != nil {
 			return err
 		}
 
@@ -167,14 +321,21 @@ func Exec() error {
 			return errors.New("empty image name or tag")
 		}
 
-		info, err := c.GetImageInfo(g_config.name, g_config.tag)
+		info, err := c.GetPlatformImageInfoContext(ctx, g_config.name, g_config.tag, g_config.platform)
 		if err != nil {
 			return err
 		}
 
 		fmt.Println("name:", info.Name)
 		fmt.Println("tag:", info.Tag)
+		fmt.Println("MediaType:", info.MediaType)
+		if info.Platform != "" {
+			fmt.Println("Platform:", info.Platform)
+		} else if info.OS != "" {
+			fmt.Println("Platform:", info.OS+"/"+info.Architecture)
+		}
 		fmt.Println("DockerVersion:", info.DockerVersion)
+		fmt.Println("CreatedTime:", info.CreatedTime)
 		fmt.Println("DigestV1:", info.DigestV1)
 		fmt.Println("DigestV2:", info.DigestV2)
 		fmt.Println("ExposedPorts:", info.ExposedPorts)
@@ -183,11 +344,40 @@ func Exec() error {
 		fmt.Println("Volumes:", info.Volumes)
 		fmt.Println("WorkingDir:", info.WorkingDir)
 		fmt.Println("Entrypoint:", info.Entrypoint)
+		fmt.Println("User:", info.User)
+		fmt.Println("Author:", info.Author)
+		fmt.Println("Labels:", len(info.Labels))
+		for _, k := range info.SortedLabelKeys() {
+			fmt.Printf("\t%s=%s\n", k, info.Labels[k])
+		}
+		if info.Healthcheck != nil {
+			fmt.Println("Healthcheck:", strings.Join(info.Healthcheck.Test, " "))
+			fmt.Println("\tInterval:", info.Healthcheck.Interval, "Timeout:", info.Healthcheck.Timeout,
+				"StartPeriod:", info.Healthcheck.StartPeriod, "Retries:", info.Healthcheck.Retries)
+		}
+		fmt.Println("StopSignal:", info.StopSignal)
+		if info.StopTimeout != nil {
+			fmt.Println("StopTimeout:", *info.StopTimeout)
+		}
+		fmt.Println("Shell:", info.Shell)
+		fmt.Println("ArgsEscaped:", info.ArgsEscaped)
+		fmt.Println("OnBuild:", info.OnBuild)
 		fmt.Println("Size:", info.HumanSize)
 
+		if len(info.Platforms) > 0 {
+			fmt.Println("Platforms", len(info.Platforms))
+			for _, platform := range info.Platforms {
+				fmt.Printf("\t%-20s\t%s\t%s\n", platform.String(), platform.Digest, platform.HumanSize)
+			}
+		}
+
 		fmt.Println("Layers", len(info.Layers))
 		for index, layer := range info.Layers {
-			fmt.Println("\tLayer", len(info.Layers)-index)
+			if layer.EmptyLayer {
+				fmt.Println("\tLayer", len(info.Layers)-index, "(empty)")
+			} else {
+				fmt.Println("\tLayer", len(info.Layers)-index)
+			}
 			fmt.Println("\t\tCreatedTime:", layer.CreatedTime)
 			fmt.Println("\t\tBlobSum:", layer.BlobSum)
 			fmt.Println("\t\tSize:", layer.HumanSize)
@@ -195,6 +385,37 @@ func Exec() error {
 			fmt.Println("")
 		}
 
+	case "get_blob":
+		if g_config.name == "" || g_config.digest == "" || g_config.out == "" {
+			return errors.New("empty image name, digest or out")
+		}
+
+		return getBlob(ctx, c)
+
+	case "copy":
+		if g_config.name == "" || g_config.tag == "" {
+			return errors.New("empty image name or tag")
+		}
+		toName, toTag := g_config.toName, g_config.toTag
+		if toName == "" {
+			toName = g_config.name
+		}
+		if toTag == "" {
+			toTag = g_config.tag
+		}
+		if toName == g_config.name && toTag == g_config.tag {
+			return errors.New("copy needs to-name or to-tag")
+		}
+
+		digest, err := copyManifest(ctx, c, g_config.name, g_config.tag, toName, toTag)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s:%s copied to %s:%s %s\n", g_config.name, g_config.tag, toName, toTag, digest)
+
+	case "bench":
+		return bench(ctx, protocol, host, options)
+
 	default:
 		return errors.New("unknown function: " + g_config.fn)
 	}
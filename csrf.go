@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// double submit cookie: pages embed the cookie value in their forms,
+// another site can make the browser send the cookie but can not read it to fill the form
+const csrfCookieName = "csrf_token"
+
+// csrfToken returns the token of this browser, setting the cookie on first visit
+func csrfToken(c *gin.Context) string {
+	if cookie, err := c.Request.Cookie(csrfCookieName); err == nil && len(cookie.Value) == 64 {
+		return cookie.Value
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token := hex.EncodeToString(b)
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token
+}
+
+// checkCSRF accepts the token from the csrf_token form field or the X-CSRF-Token header
+func checkCSRF(c *gin.Context) bool {
+	cookie, err := c.Request.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	token := c.Request.Header.Get("X-CSRF-Token")
+	if token == "" {
+		token = c.PostForm(csrfCookieName)
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) == 1
+}
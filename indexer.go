@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+// Index holds the catalog, tags and image info of the registry, crawled in the background
+// so pages do not walk the whole registry on every load
+type Index struct {
+	mutex     sync.RWMutex
+	repos     map[string]*indexedRepo
+	refreshed time.Time
+	interval  time.Duration
+}
+
+type indexedRepo struct {
+	tags      []*client.ImageInfo
+	refreshed time.Time
+}
+
+func NewIndex(interval time.Duration) *Index {
+	return &Index{repos: make(map[string]*indexedRepo), interval: interval}
+}
+
+// Run crawls the registry every interval, forever
+func (ix *Index) Run() {
+	for {
+		start := time.Now()
+		if err := ix.RefreshAll(context.Background()); err != nil {
+			fmt.Fprintln(os.Stderr, "index registry fail, error:", err.Error())
+		} else {
+			fmt.Println("index registry done in", time.Since(start))
+		}
+		time.Sleep(ix.interval)
+	}
+}
+
+func (ix *Index) RefreshAll(ctx context.Context) error {
+	catalog, err := gClient.GetCatalogContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	inCatalog := make(map[string]bool, len(catalog))
+	for _, name := range catalog {
+		inCatalog[name] = true
+		// keep what we had when a repo fails this time
+		if err := ix.RefreshRepo(ctx, name); err != nil && !errors.Is(err, client.ERR_NOT_FOUND) {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("index [%s] fail, error: %s", name, err.Error()))
+		}
+	}
+
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	for name := range ix.repos {
+		if !inCatalog[name] {
+			delete(ix.repos, name)
+		}
+	}
+	ix.refreshed = time.Now()
+
+	return nil
+}
+
+// RefreshRepo crawls the tags of one repo now, a repo gone from the registry is dropped
+func (ix *Index) RefreshRepo(ctx context.Context, name string) error {
+	tags, err := crawlTags(ctx, name)
+	if errors.Is(err, client.ERR_NOT_FOUND) {
+		ix.mutex.Lock()
+		delete(ix.repos, name)
+		ix.mutex.Unlock()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	ix.mutex.Lock()
+	ix.repos[name] = &indexedRepo{tags: tags, refreshed: time.Now()}
+	ix.mutex.Unlock()
+
+	return nil
+}
+
+// UpdateTag fetches one tag into the index, a repo not indexed yet is crawled whole
+func (ix *Index) UpdateTag(ctx context.Context, name string, tag string) error {
+	ix.mutex.RLock()
+	_, ok := ix.repos[name]
+	ix.mutex.RUnlock()
+	if !ok {
+		return ix.RefreshRepo(ctx, name)
+	}
+
+	info, err := gClient.GetImageInfoContext(ctx, name, tag)
+	if err != nil {
+		return err
+	}
+
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+
+	repo, ok := ix.repos[name]
+	if !ok {
+		repo = &indexedRepo{}
+		ix.repos[name] = repo
+	}
+
+	// Tags hands out the slice, build a new one
+	tags := make([]*client.ImageInfo, 0, len(repo.tags)+1)
+	for _, t := range repo.tags {
+		if t.Tag != tag {
+			tags = append(tags, t)
+		}
+	}
+	tags = append(tags, info)
+	sort.Sort(sort.Reverse(TimeSorterOfImageInfos(tags)))
+
+	repo.tags = tags
+	repo.refreshed = time.Now()
+	return nil
+}
+
+// RemoveTags drops tag, or every tag of digest when tag is empty, from the index
+func (ix *Index) RemoveTags(name string, digest string, tag string) {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+
+	repo, ok := ix.repos[name]
+	if !ok {
+		return
+	}
+
+	tags := make([]*client.ImageInfo, 0, len(repo.tags))
+	for _, t := range repo.tags {
+		if tag != "" && t.Tag == tag || tag == "" && digest != "" && t.DigestV2 == digest {
+			continue
+		}
+		tags = append(tags, t)
+	}
+
+	repo.tags = tags
+	repo.refreshed = time.Now()
+}
+
+// Repos lists the indexed repos having tags, ok is false until the first crawl is done
+func (ix *Index) Repos() (repos []RepoCountPair, refreshed time.Time, ok bool) {
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+
+	if ix.refreshed.IsZero() {
+		return nil, time.Time{}, false
+	}
+
+	repos = make([]RepoCountPair, 0, len(ix.repos))
+	for name, repo := range ix.repos {
+		if len(repo.tags) > 0 {
+			repos = append(repos, RepoCountPair{Repo: name, Count: len(repo.tags)})
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Repo < repos[j].Repo })
+
+	return repos, ix.refreshed, true
+}
+
+// Tags returns the indexed tags of a repo, newest first. The slice is shared, do not modify it
+func (ix *Index) Tags(name string) (tags []*client.ImageInfo, refreshed time.Time, ok bool) {
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+
+	repo, ok := ix.repos[name]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	return repo.tags, repo.refreshed, true
+}
+
+func formatRefreshed(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
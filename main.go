@@ -1,19 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mkdym/docker-registry-viewer/client"
 )
 
 var (
-	gClient   *client.RegistryClient
-	gRegistry string
+	gClient      *client.RegistryClient
+	gRegistry    string
+	gParallelism = 8
+	// nil when INDEX_INTERVAL=0, pages then query the registry directly
+	gIndex *Index
 )
 
 func main() {
@@ -45,7 +54,122 @@ func main() {
 		gRegistry = registryHost
 	}
 		
-	registryClient, err := client.NewRegistryClient(registryProtocol, gRegistry)
+	var options []client.Option
+	username, password := os.Getenv("REGISTRY_USERNAME"), os.Getenv("REGISTRY_PASSWORD")
+	if username == "" {
+		dockerConfig := os.Getenv("DOCKER_CONFIG_FILE")
+		if dockerConfig == "" {
+			dockerConfig = client.DefaultDockerConfigPath()
+		}
+		var err error
+		if username, password, err = client.LoadDockerCredentials(dockerConfig, gRegistry); err != nil {
+			panic(err)
+		}
+		if username != "" {
+			fmt.Println("registry credentials loaded from", dockerConfig)
+		}
+	}
+	if username != "" {
+		fmt.Println("registry username:", username)
+		options = append(options, client.WithCredentials(username, password))
+	}
+
+	if registryProtocol == "https" {
+		tlsOptions := client.TLSOptions{
+			CAFile:   os.Getenv("REGISTRY_CA_FILE"),
+			CertsDir: os.Getenv("REGISTRY_CERTS_DIR"),
+			CertFile: os.Getenv("REGISTRY_CLIENT_CERT"),
+			KeyFile:  os.Getenv("REGISTRY_CLIENT_KEY"),
+			Insecure: os.Getenv("REGISTRY_INSECURE") == "on",
+		}
+		if tlsOptions.Insecure {
+			fmt.Println("WARNING: registry certificate verification disabled")
+		}
+		options = append(options, client.WithTLS(tlsOptions))
+	}
+
+	if parallelism := os.Getenv("FETCH_PARALLELISM"); parallelism != "" {
+		n, err := strconv.Atoi(parallelism)
+		if err != nil || n < 1 {
+			panic("invalid FETCH_PARALLELISM " + parallelism + ", must be a positive number")
+		}
+		gParallelism = n
+	}
+	fmt.Println("fetch parallelism:", gParallelism)
+	options = append(options, client.WithParallelism(gParallelism))
+
+	cacheSize := client.DefaultCacheSize
+	if size := os.Getenv("CACHE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			panic("invalid CACHE_SIZE " + size + ", must be a positive number")
+		}
+		cacheSize = n
+	}
+	var cache client.Cache = client.NewMemoryCache(cacheSize)
+	if cacheDir := os.Getenv("CACHE_DIR"); cacheDir != "" {
+		diskCache, err := client.NewDiskCache(cacheDir)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("metadata cache dir:", cacheDir)
+		cache = client.NewLayeredCache(cache, diskCache)
+	}
+	options = append(options, client.WithCache(cache))
+
+	timeouts := client.DefaultTimeouts
+	for env, timeout := range map[string]*time.Duration{
+		"REGISTRY_DIAL_TIMEOUT":            &timeouts.Dial,
+		"REGISTRY_TLS_TIMEOUT":             &timeouts.TLSHandshake,
+		"REGISTRY_RESPONSE_HEADER_TIMEOUT": &timeouts.ResponseHeader,
+	} {
+		if value := os.Getenv(env); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				panic("invalid " + env + " " + value + ", eg, 30s, 0 for no limit")
+			}
+			*timeout = d
+		}
+	}
+	options = append(options, client.WithTimeouts(timeouts))
+
+	retry := client.DefaultRetryPolicy
+	if retries := os.Getenv("REGISTRY_RETRIES"); retries != "" {
+		n, err := strconv.Atoi(retries)
+		if err != nil || n < 0 {
+			panic("invalid REGISTRY_RETRIES " + retries + ", must be 0 or more")
+		}
+		retry.MaxRetries = n
+	}
+	options = append(options, client.WithRetry(retry))
+
+	connections := client.DefaultConnectionOptions
+	if max := os.Getenv("REGISTRY_MAX_CONNECTIONS"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil || n < 0 {
+			panic("invalid REGISTRY_MAX_CONNECTIONS " + max + ", must be 0 or more")
+		}
+		connections.MaxPerHost = n
+		if n > 0 {
+			connections.MaxIdlePerHost = n
+		}
+	}
+	options = append(options, client.WithConnections(connections))
+
+	if rate := os.Getenv("REGISTRY_RATE_LIMIT"); rate != "" {
+		perSecond, err := strconv.ParseFloat(rate, 64)
+		if err != nil || perSecond <= 0 {
+			panic("invalid REGISTRY_RATE_LIMIT " + rate + ", must be a positive number of requests per second")
+		}
+		burst := int(perSecond)
+		if burst < 1 {
+			burst = 1
+		}
+		fmt.Println("registry requests limited to", perSecond, "per second")
+		options = append(options, client.WithRateLimit(perSecond, burst))
+	}
+
+	registryClient, err := client.NewRegistryClient(registryProtocol, gRegistry, options...)
 	if err != nil {
 		panic(err)
 	}
@@ -54,36 +178,133 @@ func main() {
 	}
 	gClient = registryClient
 
+	indexInterval := 10 * time.Minute
+	if interval := os.Getenv("INDEX_INTERVAL"); interval != "" {
+		if indexInterval, err = time.ParseDuration(interval); err != nil || indexInterval < 0 {
+			panic("invalid INDEX_INTERVAL " + interval + ", eg, 10m, 0 to disable the index")
+		}
+	}
+	if indexInterval > 0 {
+		fmt.Println("index registry every", indexInterval)
+		gIndex = NewIndex(indexInterval)
+		go gIndex.Run()
+	}
+
 	r := gin.Default()
 	r.Static("/assets", "./resources/assets")
 	r.StaticFile("/favicon.ico", "./resources/favicon.ico")
 	r.LoadHTMLGlob("./resources/templates/*")
 
 	r.GET("/", handleGetRepos)
-	r.GET("/tags/:repo", handleGetTags)
-	r.GET("/detail/:repo/:tag", handleGetDetail)
-	r.GET("/layers/:repo/:tag", handleGetLayers)
-	r.GET("delete/:repo/:tag", handleDeleteImage)
+	// repository names may have several path segments, eg, /detail/team/service/api:v1
+	r.GET("/tags/*repo", handleGetTags)
+	r.GET("/detail/*image", handleGetDetail)
+	r.GET("/layers/*image", handleGetLayers)
+	r.GET("/delete/*image", handleDeleteConfirm)
+	r.POST("/delete/*image", handleDeleteImage)
+	r.POST("/refresh/*repo", handleRefreshRepo)
+	r.GET("/activity", handleGetActivity)
+	r.GET("/search", handleSearch)
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" {
+		fmt.Println("registry notifications accepted at /webhook")
+		r.POST("/webhook", handleWebhook(secret))
+	}
+
+	api := r.Group("/api/v1")
+	api.GET("/repos", apiGetRepos)
+	api.GET("/tags/*repo", apiGetTags)
+	api.GET("/images/*image", apiGetImage)
+	api.DELETE("/images/*image", apiDeleteImage)
+	api.GET("/layers/*image", apiGetLayers)
+	api.GET("/activity", apiGetActivity)
+	api.GET("/search", apiSearch)
+	api.StaticFile("/openapi.json", "./resources/openapi.json")
 
 	r.Run(":" + listenPort)
 }
 
+func repoParam(c *gin.Context) (string, error) {
+	repo, err := url.QueryUnescape(strings.Trim(c.Param("repo"), "/"))
+	if err != nil {
+		return "", err
+	}
+	if repo == "" {
+		return "", errors.New("empty repository name")
+	}
+	return repo, nil
+}
+
+// imageParam splits "team/service/api:v1" at the last ':'.
+// "repo/tag" of older links is still accepted when there is no ':'.
+func imageParam(c *gin.Context) (string, string, error) {
+	image, err := url.QueryUnescape(strings.Trim(c.Param("image"), "/"))
+	if err != nil {
+		return "", "", err
+	}
+
+	index := strings.LastIndex(image, ":")
+	if index < 0 || index < strings.LastIndex(image, "/") {
+		index = strings.LastIndex(image, "/")
+	}
+	if index <= 0 || index == len(image)-1 {
+		return "", "", errors.New("invalid image[" + image + "], expect repo:tag")
+	}
+
+	return image[:index], image[index+1:], nil
+}
+
 type RepoCountPair struct {
-	Repo  string
-	Count int
+	Repo  string `json:"name"`
+	Count int    `json:"tagCount"`
 }
 
-func handleGetRepos(c *gin.Context) {
-	catalog, err := gClient.GetCatalog()
+// errorStatus maps a client error to the http status we answer with
+func errorStatus(err error) int {
+	// the client reports what the registry has not, eg, a platform, as ERR_NOT_FOUND too
+	if errors.Is(err, client.ERR_NOT_FOUND) {
+		return http.StatusNotFound
+	}
+
+	var regErr *client.RegistryError
+	if !errors.As(err, &regErr) {
+		return http.StatusInternalServerError
+	}
+
+	switch {
+	case errors.Is(err, client.ERR_NOT_FOUND), errors.Is(err, client.ERR_NAME_UNKNOWN),
+		errors.Is(err, client.ERR_MANIFEST_UNKNOWN), errors.Is(err, client.ERR_BLOB_UNKNOWN):
+		return http.StatusNotFound
+	case errors.Is(err, client.ERR_NAME_INVALID), errors.Is(err, client.ERR_TAG_INVALID),
+		errors.Is(err, client.ERR_DIGEST_INVALID), errors.Is(err, client.ERR_MANIFEST_INVALID):
+		return http.StatusBadRequest
+	case errors.Is(err, client.ERR_UNAUTHORIZED), errors.Is(err, client.ERR_DENIED):
+		// the registry refused our credentials, not the user's
+		return http.StatusForbidden
+	case errors.Is(err, client.ERR_UNSUPPORTED):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, client.ERR_TOOMANYREQUESTS):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadGateway
+}
+
+// loadRepos serves from the index once it is built, refreshed is zero when the registry was queried directly
+func loadRepos(ctx context.Context) ([]RepoCountPair, time.Time, error) {
+	if gIndex != nil {
+		if repos, refreshed, ok := gIndex.Repos(); ok {
+			return repos, refreshed, nil
+		}
+	}
+
+	catalog, err := gClient.GetCatalogContext(ctx)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
-		return
+		return nil, time.Time{}, err
 	}
 	sort.Strings(catalog)
 
 	repos := make([]RepoCountPair, 0, len(catalog))
 	for _, name := range catalog {
-		if tags, err := gClient.GetTags(name); err == nil {
+		if tags, err := gClient.GetTagsContext(ctx, name); err == nil {
 			if len(tags) == 0 {
 				fmt.Fprintln(os.Stderr, fmt.Sprintf("get tag of [%s] success, but Zero image", name))
 			} else {
@@ -94,7 +315,39 @@ func handleGetRepos(c *gin.Context) {
 		}
 	}
 
-	c.HTML(http.StatusOK, "repos", gin.H{"registry": gRegistry, "repos": repos})
+	return repos, time.Time{}, nil
+}
+
+func handleGetRepos(c *gin.Context) {
+	page, err := pageQuery(c, repoSortKeys, "name", "asc")
+	if err != nil {
+		c.String(http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	repos, refreshed, err := loadRepos(c.Request.Context())
+	if err != nil {
+		c.String(errorStatus(err), "%s", err.Error())
+		return
+	}
+
+	sortRepos(repos, page.Sort, page.Order == "desc")
+	start, end := page.slice(len(repos))
+
+	c.HTML(http.StatusOK, "repos", gin.H{"registry": gRegistry, "repos": repos[start:end], "refreshed": formatRefreshed(refreshed),
+		"quota": formatRateLimit(), "page": page, "links": linksOf(c, page, repoSortKeys)})
+}
+
+// formatRateLimit is the quota the registry announced, empty when it never did
+func formatRateLimit() string {
+	limit, ok := gClient.RateLimit()
+	if !ok {
+		return ""
+	}
+	if limit.Limit < 0 {
+		return fmt.Sprintf("%d requests left", limit.Remaining)
+	}
+	return fmt.Sprintf("%d of %d requests left", limit.Remaining, limit.Limit)
 }
 
 type TimeSorterOfImageInfos []*client.ImageInfo
@@ -111,100 +364,339 @@ func (slice TimeSorterOfImageInfos) Swap(i, j int) {
 	slice[i], slice[j] = slice[j], slice[i]
 }
 
+// labelsQuery reads one label=key=value or label=key per selector, all must match.
+// Values may have spaces, eg, descriptions, selectors are never split
+func labelsQuery(c *gin.Context) []string {
+	var labels []string
+	for _, label := range c.QueryArray("label") {
+		if label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// fetchImageInfos gets the info of each tag with at most gParallelism requests at a time,
+// infos[i] is nil when tags[i] failed. No more requests start once ctx is done
+func fetchImageInfos(ctx context.Context, repo string, tags []string) []*client.ImageInfo {
+	infos := make([]*client.ImageInfo, len(tags))
+	sem := make(chan struct{}, gParallelism)
+	var wg sync.WaitGroup
+
+	for i, tag := range tags {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return infos
+		}
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			info, err := gClient.GetImageInfoContext(ctx, repo, tag)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Sprintf("get [%s:%s] image info fail, error: %s", repo, tag, err.Error()))
+				return
+			}
+			infos[i] = info
+		}(i, tag)
+	}
+
+	wg.Wait()
+	return infos
+}
+
+// crawlTags gets the info of every tag of repo, newest first. Tags failing to load only have Name and Tag
+func crawlTags(ctx context.Context, repo string) ([]*client.ImageInfo, error) {
+	tags, err := gClient.GetTagsContext(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := fetchImageInfos(ctx, repo, tags)
+	// a canceled crawl is incomplete, do not let it into the index
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i, info := range infos {
+		if info == nil {
+			infos[i] = &client.ImageInfo{Name: repo, Tag: tags[i]}
+		}
+	}
+
+	sort.Sort(sort.Reverse(TimeSorterOfImageInfos(infos)))
+	return infos, nil
+}
+
+// loadTags serves from the index, a repo not indexed yet is indexed now.
+// refreshed is zero when the registry was queried directly
+func loadTags(ctx context.Context, repo string, labels []string) ([]*client.ImageInfo, time.Time, error) {
+	var tags []*client.ImageInfo
+	var refreshed time.Time
+	if gIndex != nil {
+		var ok bool
+		if tags, refreshed, ok = gIndex.Tags(repo); !ok {
+			if err := gIndex.RefreshRepo(ctx, repo); err != nil {
+				return nil, time.Time{}, err
+			}
+			tags, refreshed, _ = gIndex.Tags(repo)
+		}
+	} else {
+		var err error
+		if tags, err = crawlTags(ctx, repo); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	if len(labels) == 0 {
+		return tags, refreshed, nil
+	}
+
+	tagsInfo := make([]*client.ImageInfo, 0, len(tags))
+	for _, info := range tags {
+		if info.MatchLabels(labels) {
+			tagsInfo = append(tagsInfo, info)
+		}
+	}
+	return tagsInfo, refreshed, nil
+}
+
+// loadTagsPage returns the tags of the current page sorted, and all tags loaded to get there.
+// Without the index, sorting by name needs no details, only the tags of the page are fetched then and all tags is nil
+func loadTagsPage(ctx context.Context, repo string, labels []string, page *Page) ([]*client.ImageInfo, []*client.ImageInfo, time.Time, error) {
+	if gIndex == nil && len(labels) == 0 && page.Sort == "name" {
+		tags, err := gClient.GetTagsContext(ctx, repo)
+		if err != nil {
+			return nil, nil, time.Time{}, err
+		}
+
+		sort.Strings(tags)
+		if page.Order == "desc" {
+			sort.Sort(sort.Reverse(sort.StringSlice(tags)))
+		}
+		start, end := page.slice(len(tags))
+
+		infos := fetchImageInfos(ctx, repo, tags[start:end])
+		for i, info := range infos {
+			if info == nil {
+				infos[i] = &client.ImageInfo{Name: repo, Tag: tags[start+i]}
+			}
+		}
+		return infos, nil, time.Time{}, nil
+	}
+
+	tagsInfo, refreshed, err := loadTags(ctx, repo, labels)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	tagsInfo = sortTags(tagsInfo, page.Sort, page.Order == "desc")
+	start, end := page.slice(len(tagsInfo))
+	return tagsInfo[start:end], tagsInfo, refreshed, nil
+}
+
 func handleGetTags(c *gin.Context) {
-	repo, err := url.QueryUnescape(c.Param("repo"))
+	repo, err := repoParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(http.StatusBadRequest, "%s", err.Error())
 		return
 	}
 
 	//fmt.Println("repo:", repo)
 
-	tags, err := gClient.GetTags(repo)
+	page, err := pageQuery(c, tagSortKeys, "created", "desc")
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(http.StatusBadRequest, "%s", err.Error())
 		return
 	}
 
-	tagsInfo := make([]*client.ImageInfo, 0, len(tags))
-	for _, tag := range tags {
-		if info, err := gClient.GetImageInfo(repo, tag); err == nil {
-			tagsInfo = append(tagsInfo, info)
-		} else {
-			fmt.Fprintln(os.Stderr, fmt.Sprintf("get [%s:%s] image info fail, error: %s", repo, tag, err.Error()))
-			tagsInfo = append(tagsInfo, &client.ImageInfo{})
+	labels := labelsQuery(c)
+	tagsInfo, allTags, refreshed, err := loadTagsPage(c.Request.Context(), repo, labels, &page)
+	if err != nil {
+		c.String(errorStatus(err), "%s", err.Error())
+		return
+	}
+
+	// deleting by digest removes every tag sharing it, let the dialog warn about them.
+	// Without all tags loaded the dialog can not know them, deleting goes through the confirm page instead
+	shared := make(map[string][]string)
+	for _, info := range allTags {
+		if info.DigestV2 != "" {
+			shared[info.DigestV2] = append(shared[info.DigestV2], info.Tag)
 		}
 	}
 
-	sort.Sort(sort.Reverse(TimeSorterOfImageInfos(tagsInfo)))
-	c.HTML(http.StatusOK, "tags", gin.H{"registry": gRegistry, "repo": repo, "tags": tagsInfo})
+	c.HTML(http.StatusOK, "tags", gin.H{"registry": gRegistry, "repo": repo, "labels": labels, "tags": tagsInfo,
+		"shared": shared, "sharedKnown": allTags != nil, "refreshed": formatRefreshed(refreshed), "csrf": csrfToken(c),
+		"page": page, "links": linksOf(c, page, tagSortKeys)})
 }
 
-func handleGetDetail(c *gin.Context) {
-	repo, err := url.QueryUnescape(c.Param("repo"))
+func handleRefreshRepo(c *gin.Context) {
+	if !checkCSRF(c) {
+		c.String(http.StatusForbidden, "invalid csrf token, reload the page and try again")
+		return
+	}
+
+	repo, err := repoParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(http.StatusBadRequest, "%s", err.Error())
 		return
 	}
 
-	tag, err := url.QueryUnescape(c.Param("tag"))
+	if gIndex != nil {
+		if err := gIndex.RefreshRepo(c.Request.Context(), repo); err != nil {
+			c.String(errorStatus(err), "%s", err.Error())
+			return
+		}
+	}
+
+	c.Redirect(http.StatusSeeOther, "/tags/"+repo)
+}
+
+// removeFromIndex drops what we deleted from the index right away, tag or every tag of digest when tag is empty.
+// Crawling the whole repo again would keep the user waiting on big repos
+func removeFromIndex(repo string, digest string, tag string) {
+	if gIndex != nil {
+		gIndex.RemoveTags(repo, digest, tag)
+	}
+}
+
+func handleGetDetail(c *gin.Context) {
+	repo, tag, err := imageParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(http.StatusBadRequest, "%s", err.Error())
 		return
 	}
 
 	//fmt.Println("repo:", repo, ",tag:", tag)
 
-	info, err := gClient.GetImageInfo(repo, tag)
+	platform := c.Query("platform")
+	info, err := gClient.GetPlatformImageInfoContext(c.Request.Context(), repo, tag, platform)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(errorStatus(err), "%s", err.Error())
 		return
 	}
 
-	c.HTML(http.StatusOK, "detail", gin.H{"registry": gRegistry, "repo": repo, "tag": tag, "info": info})
+	c.HTML(http.StatusOK, "detail", gin.H{"registry": gRegistry, "repo": repo, "tag": tag, "platform": platform, "info": info})
 }
 
 func handleGetLayers(c *gin.Context) {
-	repo, err := url.QueryUnescape(c.Param("repo"))
+	repo, tag, err := imageParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(http.StatusBadRequest, "%s", err.Error())
 		return
 	}
 
-	tag, err := url.QueryUnescape(c.Param("tag"))
+	//fmt.Println("repo:", repo, ",tag:", tag)
+
+	platform := c.Query("platform")
+	info, err := gClient.GetPlatformImageInfoContext(c.Request.Context(), repo, tag, platform)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(errorStatus(err), "%s", err.Error())
 		return
 	}
 
-	//fmt.Println("repo:", repo, ",tag:", tag)
+	c.HTML(http.StatusOK, "layers", gin.H{"registry": gRegistry, "repo": repo, "tag": tag, "platform": platform, "layers": info.Layers})
+}
 
-	info, err := gClient.GetImageInfo(repo, tag)
+func handleDeleteConfirm(c *gin.Context) {
+	repo, tag, err := imageParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(http.StatusBadRequest, "%s", err.Error())
 		return
 	}
 
-	c.HTML(http.StatusOK, "layers", gin.H{"registry": gRegistry, "repo": repo, "tag": tag, "layers": info.Layers})
+	digest, shared, err := gClient.TagsSharingDigestContext(c.Request.Context(), repo, tag)
+	if err != nil {
+		c.String(errorStatus(err), "%s", err.Error())
+		return
+	}
+
+	c.HTML(http.StatusOK, "delete", gin.H{"registry": gRegistry, "repo": repo, "tag": tag, "digest": digest,
+		"shared": shared, "csrf": csrfToken(c)})
+}
+
+// tagsMissing returns the tags not in confirmed
+func tagsMissing(tags []string, confirmed []string) []string {
+	known := make(map[string]bool, len(confirmed))
+	for _, tag := range confirmed {
+		known[tag] = true
+	}
+
+	var missing []string
+	for _, tag := range tags {
+		if !known[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	return missing
 }
 
 func handleDeleteImage(c *gin.Context) {
-	repo, err := url.QueryUnescape(c.Param("repo"))
-	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+	if !checkCSRF(c) {
+		c.String(http.StatusForbidden, "invalid csrf token, reload the page and try again")
 		return
 	}
 
-	tag, err := url.QueryUnescape(c.Param("tag"))
+	repo, tag, err := imageParam(c)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+		c.String(http.StatusBadRequest, "%s", err.Error())
 		return
 	}
 
 	//fmt.Println("repo:", repo, ",tag:", tag)
 
-	if err := gClient.DeleteTag(repo, tag); err != nil {
-		c.String(http.StatusInternalServerError, "%s", err.Error())
+	// the digest confirmed by the user, refuse if the tag was pushed again meanwhile
+	digest := c.PostForm("digest")
+	if c.PostForm("untag") != "" {
+		if digest != "" {
+			current, err := gClient.GetDigestContext(c.Request.Context(), repo, tag)
+			if err != nil {
+				c.String(errorStatus(err), "%s", err.Error())
+				return
+			}
+			if current != digest {
+				c.String(http.StatusConflict, "%s:%s now points at %s instead of %s, not deleted", repo, tag, current, digest)
+				return
+			}
+		}
+
+		// untag removes only this tag, the others sharing its digest stay
+		if err := gClient.UntagTagContext(c.Request.Context(), repo, tag); err != nil {
+			c.String(errorStatus(err), "%s", err.Error())
+			return
+		}
+		removeFromIndex(repo, "", tag)
+	} else {
+		// the tags shown to the user may be as old as the index, refuse if others got the digest meanwhile
+		current, shared, err := gClient.TagsSharingDigestContext(c.Request.Context(), repo, tag)
+		if err != nil {
+			c.String(errorStatus(err), "%s", err.Error())
+			return
+		}
+		if digest != "" && current != digest {
+			c.String(http.StatusConflict, "%s:%s now points at %s instead of %s, not deleted", repo, tag, current, digest)
+			return
+		}
+		if unconfirmed := tagsMissing(shared, strings.Fields(c.PostForm("shared"))); len(unconfirmed) > 0 {
+			c.String(http.StatusConflict, "%s now also has tags %s which would be deleted too, not deleted, reload and confirm again",
+				current, strings.Join(unconfirmed, ", "))
+			return
+		}
+
+		if err := gClient.DeleteManifestContext(c.Request.Context(), repo, current); err != nil {
+			c.String(errorStatus(err), "%s", err.Error())
+			return
+		}
+		removeFromIndex(repo, current, "")
+	}
+
+	if c.PostForm("redirect") != "" {
+		c.Redirect(http.StatusSeeOther, "/tags/"+repo)
 		return
 	}
 
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// Page tells which part of a sorted list a response holds
+type Page struct {
+	Page    int    `json:"page"`
+	PerPage int    `json:"perPage"`
+	Total   int    `json:"total"`
+	Pages   int    `json:"pages"`
+	Sort    string `json:"sort"`
+	Order   string `json:"order"`
+}
+
+// pageQuery reads page, per_page, sort (one of keys) and order (asc or desc)
+func pageQuery(c *gin.Context, keys []string, defaultSort string, defaultOrder string) (Page, error) {
+	p := Page{Page: 1, PerPage: defaultPerPage, Sort: defaultSort, Order: defaultOrder}
+
+	var err error
+	if s := c.Query("page"); s != "" {
+		if p.Page, err = strconv.Atoi(s); err != nil || p.Page < 1 {
+			return p, errors.New("invalid page " + s)
+		}
+	}
+	if s := c.Query("per_page"); s != "" {
+		if p.PerPage, err = strconv.Atoi(s); err != nil || p.PerPage < 1 || p.PerPage > maxPerPage {
+			return p, errors.New("invalid per_page " + s + ", must be 1 to " + strconv.Itoa(maxPerPage))
+		}
+	}
+	if s := c.Query("sort"); s != "" {
+		if !containsString(keys, s) {
+			return p, errors.New("invalid sort " + s + ", must be one of " + strings.Join(keys, ", "))
+		}
+		p.Sort = s
+		// a new sort key starts in its natural order
+		p.Order = "asc"
+		if s != "name" {
+			p.Order = "desc"
+		}
+	}
+	if s := c.Query("order"); s != "" {
+		if s != "asc" && s != "desc" {
+			return p, errors.New("invalid order " + s + ", must be asc or desc")
+		}
+		p.Order = s
+	}
+
+	return p, nil
+}
+
+// slice sets Total and Pages, and returns the bounds of the current page in a list of total items
+func (p *Page) slice(total int) (int, int) {
+	p.Total = total
+	p.Pages = (total + p.PerPage - 1) / p.PerPage
+
+	start := (p.Page - 1) * p.PerPage
+	if start > total {
+		start = total
+	}
+	end := start + p.PerPage
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+var (
+	repoSortKeys = []string{"name", "tags"}
+	tagSortKeys  = []string{"name", "created", "size", "layers"}
+)
+
+// sortRepos sorts in place, ties by name
+func sortRepos(repos []RepoCountPair, key string, desc bool) {
+	sort.SliceStable(repos, func(i, j int) bool {
+		a, b := repos[i], repos[j]
+		if key == "tags" && a.Count != b.Count {
+			return (a.Count < b.Count) != desc
+		}
+		return (a.Repo < b.Repo) != desc
+	})
+}
+
+// sortTags returns a sorted copy, the index shares its slices
+func sortTags(tags []*client.ImageInfo, key string, desc bool) []*client.ImageInfo {
+	sorted := make([]*client.ImageInfo, len(tags))
+	copy(sorted, tags)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case key == "created" && a.CreatedTime != b.CreatedTime:
+			return (a.CreatedTime < b.CreatedTime) != desc
+		case key == "size" && a.Size != b.Size:
+			return (a.Size < b.Size) != desc
+		case key == "layers" && len(a.Layers) != len(b.Layers):
+			return (len(a.Layers) < len(b.Layers)) != desc
+		}
+		return (a.Tag < b.Tag) != desc
+	})
+	return sorted
+}
+
+type pageLink struct {
+	Number int
+	URL    string
+	Active bool
+}
+
+// pageLinks are the urls of the pager and of the sortable column headers, other query params kept
+type pageLinks struct {
+	Prev    string
+	Next    string
+	Numbers []pageLink
+	Sort    map[string]string
+}
+
+func linksOf(c *gin.Context, p Page, keys []string) pageLinks {
+	link := func(page int, sort string, order string) string {
+		query := c.Request.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("sort", sort)
+		query.Set("order", order)
+		return c.Request.URL.Path + "?" + query.Encode()
+	}
+
+	var links pageLinks
+	if p.Page > 1 {
+		links.Prev = link(p.Page-1, p.Sort, p.Order)
+	}
+	if p.Page < p.Pages {
+		links.Next = link(p.Page+1, p.Sort, p.Order)
+	}
+
+	// first, last and the pages around the current one
+	for n := 1; n <= p.Pages; n++ {
+		if n == 1 || n == p.Pages || (n >= p.Page-4 && n <= p.Page+4) {
+			links.Numbers = append(links.Numbers, pageLink{Number: n, URL: link(n, p.Sort, p.Order), Active: n == p.Page})
+		} else if len(links.Numbers) > 0 && links.Numbers[len(links.Numbers)-1].Number != 0 {
+			links.Numbers = append(links.Numbers, pageLink{})
+		}
+	}
+
+	links.Sort = make(map[string]string)
+	for _, key := range keys {
+		order := "asc"
+		if key != "name" {
+			order = "desc"
+		}
+		if key == p.Sort {
+			order = map[string]string{"asc": "desc", "desc": "asc"}[p.Order]
+		}
+		links.Sort[key] = link(1, key, order)
+	}
+
+	return links
+}
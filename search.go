@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+const searchLimit = 500
+
+type searchQuery struct {
+	Text          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	MinSize       uint64
+	MaxSize       uint64
+}
+
+type SearchHit struct {
+	Repository string   `json:"repository"`
+	Tag        string   `json:"tag"`
+	Digest     string   `json:"digest"`
+	Created    string   `json:"created"`
+	Size       uint64   `json:"size"`
+	HumanSize  string   `json:"humanSize"`
+	Matched    []string `json:"matched"`
+}
+
+type SearchResult struct {
+	Repositories []RepoCountPair `json:"repositories"`
+	Tags         []SearchHit     `json:"tags"`
+	Truncated    bool            `json:"truncated"`
+}
+
+// parseTime takes RFC 3339 or a date, 2006-01-02
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time " + s + ", eg, 2024-01-31 or 2024-01-31T10:00:00Z")
+	}
+	return t, nil
+}
+
+// parseSize takes bytes with an optional K, M, G or T suffix, eg, 1.5G
+func parseSize(s string) (uint64, error) {
+	units := map[string]float64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+
+	// 1.5G, 1.5GB and 1.5GiB are all the same here
+	number := strings.ToUpper(strings.TrimSpace(s))
+	number = strings.TrimSuffix(strings.TrimSuffix(number, "B"), "I")
+
+	unit := strings.TrimLeft(number, "0123456789.")
+	multiplier, ok := units[unit]
+	value, err := strconv.ParseFloat(strings.TrimSuffix(number, unit), 64)
+	if !ok || err != nil || value < 0 {
+		return 0, errors.New("invalid size " + s + ", eg, 1024, 512K, 1.5G")
+	}
+	return uint64(value * multiplier), nil
+}
+
+func searchQueryParams(c *gin.Context) (searchQuery, error) {
+	q := searchQuery{Text: strings.TrimSpace(c.Query("q"))}
+
+	var err error
+	if s := c.Query("created_after"); s != "" {
+		if q.CreatedAfter, err = parseTime(s); err != nil {
+			return q, err
+		}
+	}
+	if s := c.Query("created_before"); s != "" {
+		if q.CreatedBefore, err = parseTime(s); err != nil {
+			return q, err
+		}
+	}
+	if s := c.Query("min_size"); s != "" {
+		if q.MinSize, err = parseSize(s); err != nil {
+			return q, err
+		}
+	}
+	if s := c.Query("max_size"); s != "" {
+		if q.MaxSize, err = parseSize(s); err != nil {
+			return q, err
+		}
+	}
+
+	return q, nil
+}
+
+func (q searchQuery) empty() bool {
+	return q.Text == "" && q.CreatedAfter.IsZero() && q.CreatedBefore.IsZero() && q.MinSize == 0 && q.MaxSize == 0
+}
+
+func (q searchQuery) hasFilters() bool {
+	return !q.CreatedAfter.IsZero() || !q.CreatedBefore.IsZero() || q.MinSize > 0 || q.MaxSize > 0
+}
+
+// filter reports whether info passes the created and size ranges
+func (q searchQuery) filter(info *client.ImageInfo) bool {
+	if !q.CreatedAfter.IsZero() || !q.CreatedBefore.IsZero() {
+		created, err := time.Parse(time.RFC3339Nano, info.CreatedTime)
+		if err != nil {
+			return false
+		}
+		if !q.CreatedAfter.IsZero() && created.Before(q.CreatedAfter) {
+			return false
+		}
+		if !q.CreatedBefore.IsZero() && !created.Before(q.CreatedBefore) {
+			return false
+		}
+	}
+
+	if q.MinSize > 0 && info.Size < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && info.Size > q.MaxSize {
+		return false
+	}
+
+	return true
+}
+
+// digestMatch takes a digest prefix with or without algorithm, eg, sha256:ab12 or ab12
+func digestMatch(digest string, text string) bool {
+	if digest == "" {
+		return false
+	}
+	if strings.Contains(text, ":") {
+		return strings.HasPrefix(digest, text)
+	}
+	if len(text) < 4 || strings.Trim(text, "0123456789abcdef") != "" {
+		return false
+	}
+	parts := strings.SplitN(digest, ":", 2)
+	return len(parts) == 2 && strings.HasPrefix(parts[1], text)
+}
+
+// match lists what of info contains text: repository, tag, label, digest
+func match(info *client.ImageInfo, text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	var matched []string
+	if strings.Contains(strings.ToLower(info.Name), text) {
+		matched = append(matched, "repository")
+	}
+	if strings.Contains(strings.ToLower(info.Tag), text) {
+		matched = append(matched, "tag")
+	}
+	for k, v := range info.Labels {
+		if strings.Contains(strings.ToLower(k), text) || strings.Contains(strings.ToLower(v), text) {
+			matched = append(matched, "label")
+			break
+		}
+	}
+
+	digestMatched := digestMatch(info.DigestV2, text) || digestMatch(info.DigestV1, text)
+	for _, p := range info.Platforms {
+		digestMatched = digestMatched || digestMatch(p.Digest, text)
+	}
+	if digestMatched {
+		matched = append(matched, "digest")
+	}
+
+	return matched
+}
+
+// Search looks for q in the index, ok is false until the first crawl is done
+func (ix *Index) Search(q searchQuery) (result SearchResult, ok bool) {
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+
+	if ix.refreshed.IsZero() {
+		return result, false
+	}
+
+	text := strings.ToLower(q.Text)
+	result.Repositories = []RepoCountPair{}
+	result.Tags = []SearchHit{}
+
+	names := make([]string, 0, len(ix.repos))
+	for name := range ix.repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo := ix.repos[name]
+		if text != "" && strings.Contains(strings.ToLower(name), text) && len(repo.tags) > 0 {
+			result.Repositories = append(result.Repositories, RepoCountPair{Repo: name, Count: len(repo.tags)})
+		}
+
+		for _, info := range repo.tags {
+			matched := match(info, text)
+			if text != "" && len(matched) == 0 || !q.filter(info) {
+				continue
+			}
+			// a repository name match alone lists the repository, not all its tags, unless filtered
+			if len(matched) == 1 && matched[0] == "repository" && !q.hasFilters() {
+				continue
+			}
+
+			if len(result.Tags) == searchLimit {
+				result.Truncated = true
+				return result, true
+			}
+			result.Tags = append(result.Tags, SearchHit{
+				Repository: info.Name,
+				Tag:        info.Tag,
+				Digest:     info.DigestV2,
+				Created:    info.CreatedTime,
+				Size:       info.Size,
+				HumanSize:  info.HumanSize,
+				Matched:    matched,
+			})
+		}
+	}
+
+	return result, true
+}
+
+// search returns the http status to answer with on error
+func search(c *gin.Context) (SearchResult, int, error) {
+	q, err := searchQueryParams(c)
+	if err != nil {
+		return SearchResult{}, http.StatusBadRequest, err
+	}
+
+	if gIndex == nil {
+		return SearchResult{}, http.StatusServiceUnavailable, errors.New("search needs the index, INDEX_INTERVAL must not be 0")
+	}
+	if q.empty() {
+		return SearchResult{Repositories: []RepoCountPair{}, Tags: []SearchHit{}}, http.StatusOK, nil
+	}
+
+	result, ok := gIndex.Search(q)
+	if !ok {
+		return result, http.StatusServiceUnavailable, errors.New("the registry is still being indexed, try again later")
+	}
+	return result, http.StatusOK, nil
+}
+
+func handleSearch(c *gin.Context) {
+	result, status, err := search(c)
+	if err != nil {
+		c.String(status, "%s", err.Error())
+		return
+	}
+
+	c.HTML(http.StatusOK, "search", gin.H{"registry": gRegistry, "q": c.Query("q"),
+		"createdAfter": c.Query("created_after"), "createdBefore": c.Query("created_before"),
+		"minSize": c.Query("min_size"), "maxSize": c.Query("max_size"), "result": result})
+}
+
+func apiSearch(c *gin.Context) {
+	result, status, err := search(c)
+	if err != nil {
+		abortAPI(c, status, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mkdym/docker-registry-viewer/client"
+)
+
+// envelope of registry notifications, https://docs.docker.com/registry/notifications/
+type notificationEnvelope struct {
+	Events []notificationEvent `json:"events"`
+}
+
+type notificationEvent struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Target    struct {
+		MediaType  string `json:"mediaType"`
+		Size       uint64 `json:"size"`
+		Digest     string `json:"digest"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+	} `json:"target"`
+	Request struct {
+		Addr      string `json:"addr"`
+		UserAgent string `json:"useragent"`
+	} `json:"request"`
+	Actor struct {
+		Name string `json:"name"`
+	} `json:"actor"`
+}
+
+type Activity struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag,omitempty"`
+	Digest     string    `json:"digest"`
+	MediaType  string    `json:"mediaType"`
+	Size       uint64    `json:"size"`
+	HumanSize  string    `json:"humanSize"`
+	Actor      string    `json:"actor"`
+	Addr       string    `json:"addr"`
+	UserAgent  string    `json:"userAgent"`
+}
+
+const activityFeedSize = 500
+
+// ActivityFeed keeps the latest activities, newest first
+type ActivityFeed struct {
+	mutex      sync.RWMutex
+	activities []Activity
+}
+
+var gActivity = &ActivityFeed{}
+
+// Add reports false for an activity already in the feed, the registry retries deliveries
+func (f *ActivityFeed) Add(a Activity) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, old := range f.activities {
+		if old.ID == a.ID {
+			return false
+		}
+	}
+
+	f.activities = append([]Activity{a}, f.activities...)
+	if len(f.activities) > activityFeedSize {
+		f.activities = f.activities[:activityFeedSize]
+	}
+	return true
+}
+
+// List returns the activities with one of actions (all if empty), newest first
+func (f *ActivityFeed) List(actions []string) []Activity {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	result := make([]Activity, 0, len(f.activities))
+	for _, a := range f.activities {
+		if len(actions) == 0 || containsString(actions, a.Action) {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWebhookSecret accepts the secret as "Authorization: Bearer <secret>", set in the headers of the registry's notification endpoint
+func checkWebhookSecret(c *gin.Context, secret string) bool {
+	auth := c.Request.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+func handleWebhook(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkWebhookSecret(c, secret) {
+			c.String(http.StatusUnauthorized, "invalid webhook secret")
+			return
+		}
+
+		var envelope notificationEnvelope
+		if err := json.NewDecoder(c.Request.Body).Decode(&envelope); err != nil {
+			c.String(http.StatusBadRequest, "invalid notification envelope, error: %s", err.Error())
+			return
+		}
+
+		for _, event := range envelope.Events {
+			// blob events and manifests pushed by digest (platforms of an index) are noise, keep tags and deletes
+			if event.Target.Repository == "" || (event.Target.Tag == "" && event.Action != "delete") {
+				continue
+			}
+
+			a := Activity{
+				ID:         event.ID,
+				Time:       event.Timestamp,
+				Action:     event.Action,
+				Repository: event.Target.Repository,
+				Tag:        event.Target.Tag,
+				Digest:     event.Target.Digest,
+				MediaType:  event.Target.MediaType,
+				Size:       event.Target.Size,
+				HumanSize:  client.HumanSize(event.Target.Size),
+				Actor:      event.Actor.Name,
+				Addr:       event.Request.Addr,
+				UserAgent:  event.Request.UserAgent,
+			}
+			if a.Time.IsZero() {
+				a.Time = time.Now()
+			}
+			if !gActivity.Add(a) {
+				continue
+			}
+
+			// answer the registry now, fetching image info may take a while
+			if gIndex != nil && (a.Action == "push" || a.Action == "delete") {
+				go updateIndex(a)
+			}
+		}
+
+		c.Status(http.StatusOK)
+	}
+}
+
+func updateIndex(a Activity) {
+	var err error
+	switch a.Action {
+	case "push":
+		err = gIndex.UpdateTag(context.Background(), a.Repository, a.Tag)
+	case "delete":
+		gIndex.RemoveTags(a.Repository, a.Digest, a.Tag)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("index [%s:%s] after %s fail, error: %s", a.Repository, a.Tag, a.Action, err.Error()))
+	}
+}
+
+func actionsQuery(c *gin.Context) []string {
+	var actions []string
+	for _, action := range c.QueryArray("action") {
+		actions = append(actions, strings.Fields(action)...)
+	}
+	return actions
+}
+
+func handleGetActivity(c *gin.Context) {
+	actions := actionsQuery(c)
+	c.HTML(http.StatusOK, "activity", gin.H{"registry": gRegistry, "actions": strings.Join(actions, " "), "activities": gActivity.List(actions)})
+}
+
+func apiGetActivity(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"registry": gRegistry, "activities": gActivity.List(actionsQuery(c))})
+}